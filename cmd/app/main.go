@@ -6,28 +6,50 @@ import (
 	"github.com/jackc/pgx/v4"
 	"github.com/joho/godotenv"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"ozon-GraphQL/graph"
-	graph2 "ozon-GraphQL/graph"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/cursor"
 	"ozon-GraphQL/internal/database"
 	"ozon-GraphQL/internal/database/storage"
+	"ozon-GraphQL/internal/pubsub"
+	"ozon-GraphQL/internal/server"
+	"strconv"
+	"syscall"
 	"time"
 
-	"github.com/99designs/gqlgen/graphql/handler"
-	"github.com/99designs/gqlgen/graphql/handler/extension"
-	"github.com/99designs/gqlgen/graphql/handler/lru"
-	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
-	"github.com/vektah/gqlparser/v2/ast"
 )
 
 const defaultPort = "8080"
 
+const defaultQueryTimeout = 5 * time.Second
+
+// shutdownTimeout bounds how long requests in flight may take to finish once
+// a shutdown is requested.
+const shutdownTimeout = 10 * time.Second
+
+const (
+	defaultFileStorageDir = "data"
+	defaultSnapshotEvery  = 1000
+	defaultSQLitePath     = "data/app.db"
+)
+
 func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run returns instead of exiting on errors, so that the storage opened so far
+// is closed by its defers.
+func run() error {
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		return fmt.Errorf("Error loading .env file: %v", err)
 	}
 
 	port := os.Getenv("PORT")
@@ -41,52 +63,187 @@ func main() {
 	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
 	storageType := os.Getenv("STORAGE_TYPE")
-
-	var repo database.Repository
+	brokerType := os.Getenv("SUBSCRIPTION_BROKER")
 
 	if storageType == "" {
-		log.Fatalf("Error: STORAGE_TYPE environment variable not set")
+		return fmt.Errorf("Error: STORAGE_TYPE environment variable not set")
+	}
+
+	// The rest of the configuration is read before the storage is opened:
+	// the env helpers exit on invalid values.
+	policy, err := pubsub.ParsePolicy(os.Getenv("SUBSCRIPTION_SLOW_CONSUMER"))
+	if err != nil {
+		return fmt.Errorf("Error: %v", err)
+	}
+	brokerOpts := pubsub.Options{
+		BufferSize: envInt("SUBSCRIPTION_BUFFER_SIZE", pubsub.DefaultBufferSize),
+		Policy:     policy,
+	}
+
+	if brokerType == "" {
+		brokerType = "memory"
+		if storageType == "postgres" {
+			brokerType = "postgres"
+		}
+	}
+	if brokerType == "postgres" && storageType != "postgres" {
+		return fmt.Errorf("Error: SUBSCRIPTION_BROKER=postgres requires STORAGE_TYPE=postgres")
+	}
+	if brokerType != "postgres" && brokerType != "memory" {
+		return fmt.Errorf("Error: unknown SUBSCRIPTION_BROKER %q", brokerType)
 	}
 
+	if secret := os.Getenv("CURSOR_SECRET"); secret != "" {
+		cursor.SetSecret([]byte(secret))
+	}
+
+	serverCfg := server.DefaultConfig()
+	serverCfg.WebsocketEnabled = envBool("WS_ENABLED", serverCfg.WebsocketEnabled)
+	serverCfg.KeepAlivePingInterval = envDuration("WS_KEEPALIVE_INTERVAL", serverCfg.KeepAlivePingInterval)
+	serverCfg.InitTimeout = envDuration("WS_INIT_TIMEOUT", serverCfg.InitTimeout)
+	serverCfg.SSEEnabled = envBool("SSE_ENABLED", serverCfg.SSEEnabled)
+	serverCfg.SSEKeepAliveInterval = envDuration("SSE_KEEPALIVE_INTERVAL", serverCfg.SSEKeepAliveInterval)
+	serverCfg.ComplexityLimit = envInt("QUERY_COMPLEXITY_LIMIT", serverCfg.ComplexityLimit)
+	serverCfg.MaxDepth = envInt("QUERY_MAX_DEPTH", serverCfg.MaxDepth)
+
+	pagination := graph.DefaultPagePolicy()
+	pagination.DefaultSize = envInt("PAGE_SIZE_DEFAULT", pagination.DefaultSize)
+	pagination.MaxSize = envInt("PAGE_SIZE_MAX", pagination.MaxSize)
+	if pagination.DefaultSize <= 0 || pagination.DefaultSize > pagination.MaxSize {
+		return fmt.Errorf("Error: PAGE_SIZE_DEFAULT must be between 1 and PAGE_SIZE_MAX")
+	}
+
+	poolCfg := database.PoolConfig{
+		MinConns:          int32(envInt("DB_POOL_MIN_CONNS", 0)),
+		MaxConns:          int32(envInt("DB_POOL_MAX_CONNS", 0)),
+		MaxConnIdleTime:   envDuration("DB_POOL_MAX_CONN_IDLE_TIME", 0),
+		HealthCheckPeriod: envDuration("DB_POOL_HEALTH_CHECK_PERIOD", 0),
+	}
+	queryTimeout := envDuration("DB_QUERY_TIMEOUT", defaultQueryTimeout)
+	fileStorageDir := envString("FILE_STORAGE_DIR", defaultFileStorageDir)
+	snapshotEvery := envInt("FILE_STORAGE_SNAPSHOT_EVERY", defaultSnapshotEvery)
+	sqlitePath := envString("SQLITE_PATH", defaultSQLitePath)
+
+	// ctx is cancelled on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var repo database.Repository
+	var db *database.Pool
+
+	connStr := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable",
+		dbUser, dbPassword, dbName, dbHost, dbPort)
+
 	if storageType == "postgres" {
 		err = waitForDatabase(dbUser, dbPassword, dbName, dbHost, dbPort)
 		if err != nil {
-			log.Fatalf("Error waiting for database: %v", err)
+			return fmt.Errorf("Error waiting for database: %v", err)
 		}
 
-		connStr := fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%s sslmode=disable",
-			dbUser, dbPassword, dbName, dbHost, dbPort)
-
-		db, err := pgx.Connect(context.Background(), connStr)
+		db, err = database.NewPool(ctx, connStr, poolCfg)
 		if err != nil {
-			log.Fatalf("failed to connect to the database: %v", err)
+			return fmt.Errorf("failed to connect to the database: %v", err)
 		}
-		defer db.Close(context.Background())
+		defer db.Close()
 
-		repo = storage.NewPostgresSQLRepository(db)
+		repo = storage.NewPostgresSQLRepository(db, queryTimeout)
 
 	} else if storageType == "in_memory" {
 		repo = storage.NewInMemoryRepository()
+	} else if storageType == "file" {
+		fileRepo, err := storage.NewFileRepository(fileStorageDir, snapshotEvery)
+		if err != nil {
+			return fmt.Errorf("failed to open the file storage: %v", err)
+		}
+		defer func() {
+			if err := fileRepo.Close(); err != nil {
+				log.Printf("failed to close the file storage: %v", err)
+			}
+		}()
+
+		repo = fileRepo
+	} else if storageType == "sqlite" {
+		sqliteDB, err := database.OpenSQLite(sqlitePath)
+		if err != nil {
+			return fmt.Errorf("failed to open the SQLite database: %v", err)
+		}
+		defer func() {
+			if err := sqliteDB.Close(); err != nil {
+				log.Printf("failed to close the SQLite database: %v", err)
+			}
+		}()
+
+		repo = storage.NewSQLiteRepository(sqliteDB)
+	} else {
+		return fmt.Errorf("Error: unknown STORAGE_TYPE %q", storageType)
+	}
+
+	var comments pubsub.Broker[*model.Comment]
+	var posts pubsub.Broker[*model.Post]
+
+	if brokerType == "postgres" {
+		connect := func(ctx context.Context) (*pgx.Conn, error) {
+			return pgx.Connect(ctx, connStr)
+		}
+		commentBroker := pubsub.NewPostgresBroker[*model.Comment](db, connect, "comment_added",
+			func(comment *model.Comment) string { return comment.ID }, repo.GetCommentByID, brokerOpts)
+		postBroker := pubsub.NewPostgresBroker[*model.Post](db, connect, "post_created",
+			func(post *model.Post) string { return post.ID }, repo.GetPostByID, brokerOpts)
+
+		go commentBroker.Listen(ctx)
+		go postBroker.Listen(ctx)
+
+		comments, posts = commentBroker, postBroker
+	} else {
+		comments = pubsub.NewMemoryBroker[*model.Comment](brokerOpts)
+		posts = pubsub.NewMemoryBroker[*model.Post](brokerOpts)
 	}
-	resolver := graph.NewResolver(repo)
-	srv := handler.New(graph2.NewExecutableSchema(graph2.Config{Resolvers: resolver}))
 
-	srv.AddTransport(transport.Options{})
-	srv.AddTransport(transport.GET{})
-	srv.AddTransport(transport.POST{})
+	resolver := graph.NewResolver(repo, comments, posts)
+	resolver.Pagination = pagination
+	srv := server.New(resolver, serverCfg)
 
-	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+	mux := http.NewServeMux()
+	mux.Handle("/", playground.Handler("GraphQL playground", "/query"))
+	mux.Handle("/query", srv)
+	if db != nil {
+		mux.Handle("/debug/pool", server.PoolStatsHandler(func() database.PoolStats {
+			return database.Stats(db)
+		}))
+	}
 
-	srv.Use(extension.Introspection{})
-	srv.Use(extension.AutomaticPersistedQuery{
-		Cache: lru.New[string](100),
-	})
+	// Requests are cancelled once the server has shut down, before the
+	// storage is closed, which ends the subscriptions Shutdown doesn't wait
+	// for or gave up on.
+	requests, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
-	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", srv)
+	httpServer := &http.Server{
+		Addr:        ":" + port,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return requests },
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- httpServer.ListenAndServe()
+	}()
 
 	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("requests still running after %s, closing them: %v", shutdownTimeout, err)
+		return httpServer.Close()
+	}
+	return nil
 }
 
 func waitForDatabase(user, password, dbName, host, port string) error {
@@ -111,3 +268,46 @@ func waitForDatabase(user, password, dbName, host, port string) error {
 		}
 	}
 }
+
+func envString(key string, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+func envBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Error: invalid %s: %v", key, err)
+	}
+	return b
+}
+
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Error: invalid %s: %v", key, err)
+	}
+	return n
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Error: invalid %s: %v", key, err)
+	}
+	return d
+}
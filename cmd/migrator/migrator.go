@@ -6,17 +6,21 @@ import (
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/joho/godotenv"
 	"os"
+	"path/filepath"
 )
 
 func main() {
-	var migrationsPath, migrationsTable, action string
+	var migrationsPath, migrationsTable, action, databaseType, sqlitePath string
 
 	flag.StringVar(&migrationsPath, "migrations-path", "", "path to migrations")
 	flag.StringVar(&migrationsTable, "migrations-table", "migrations", "name of migrations table")
 	flag.StringVar(&action, "action", "up", "migration action: up or down")
+	flag.StringVar(&databaseType, "database", "postgres", "database to migrate: postgres or sqlite")
+	flag.StringVar(&sqlitePath, "sqlite-path", "", "SQLite database file, SQLITE_PATH or data/app.db by default")
 	flag.Parse()
 
 	if migrationsPath == "" {
@@ -27,18 +31,33 @@ func main() {
 		panic(fmt.Errorf("Error loading .env file in migratgor"))
 	}
 
-	postgresUser := os.Getenv("DB_USER")
-	postgresPassword := os.Getenv("DB_PASSWORD")
-	postgresHost := "localhost"
-	postgresPort := "5434"
-	postgresDB := os.Getenv("DB_NAME")
-	fmt.Println(fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		postgresUser, postgresPassword, postgresHost, postgresPort, postgresDB))
-	m, err := migrate.New(
-		"file://"+migrationsPath,
-		fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
-			postgresUser, postgresPassword, postgresHost, postgresPort, postgresDB),
-	)
+	var databaseURL string
+	switch databaseType {
+	case "postgres":
+		postgresUser := os.Getenv("DB_USER")
+		postgresPassword := os.Getenv("DB_PASSWORD")
+		postgresHost := "localhost"
+		postgresPort := "5434"
+		postgresDB := os.Getenv("DB_NAME")
+		databaseURL = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+			postgresUser, postgresPassword, postgresHost, postgresPort, postgresDB)
+		fmt.Println(databaseURL)
+	case "sqlite":
+		if sqlitePath == "" {
+			sqlitePath = os.Getenv("SQLITE_PATH")
+		}
+		if sqlitePath == "" {
+			sqlitePath = "data/app.db"
+		}
+		if err := os.MkdirAll(filepath.Dir(sqlitePath), 0o755); err != nil {
+			panic(err)
+		}
+		databaseURL = "sqlite3://" + sqlitePath
+	default:
+		panic(fmt.Errorf("unknown database %q, use postgres or sqlite", databaseType))
+	}
+
+	m, err := migrate.New("file://"+migrationsPath, databaseURL)
 	if err != nil {
 		panic(err)
 	}
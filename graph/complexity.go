@@ -0,0 +1,38 @@
+package graph
+
+import "ozon-GraphQL/graph/model"
+
+// pageComplexity charges a connection for every node it can return.
+func pageComplexity(policy PagePolicy, childComplexity int, first, last *int32) int {
+	size := policy.DefaultSize
+	if first != nil {
+		size = int(*first)
+	} else if last != nil {
+		size = int(*last)
+	}
+	if size < 1 {
+		size = 1
+	}
+	return 1 + size*childComplexity
+}
+
+// NewComplexityRoot prices the connection fields by the number of nodes they
+// can return, so nested replies get more expensive with every level.
+func NewComplexityRoot(policy PagePolicy) ComplexityRoot {
+	var c ComplexityRoot
+
+	c.Query.Posts = func(childComplexity int, first *int32, after *string, last *int32, before *string, orderBy *model.SortOrder) int {
+		return pageComplexity(policy, childComplexity, first, last)
+	}
+	c.Query.Comments = func(childComplexity int, postID string, first *int32, after *string, last *int32, before *string, orderBy *model.SortOrder) int {
+		return pageComplexity(policy, childComplexity, first, last)
+	}
+	c.Query.CommentThread = func(childComplexity int, postID string, maxDepth *int32, first *int32, after *string) int {
+		return pageComplexity(policy, childComplexity, first, nil)
+	}
+	c.Comment.Replies = func(childComplexity int, first *int32, after *string, last *int32, before *string, orderBy *model.SortOrder) int {
+		return pageComplexity(policy, childComplexity, first, last)
+	}
+
+	return c
+}
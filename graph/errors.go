@@ -0,0 +1,63 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"log"
+	"ozon-GraphQL/internal/database"
+)
+
+const (
+	CodeNotFound         = "NOT_FOUND"
+	CodeCommentsDisabled = "COMMENTS_DISABLED"
+	CodeInvalidCursor    = "INVALID_CURSOR"
+	CodeBadUserInput     = "BAD_USER_INPUT"
+	CodeForbidden        = "FORBIDDEN"
+	CodeInternal         = "INTERNAL_SERVER_ERROR"
+)
+
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{database.ErrNotFound, CodeNotFound},
+	{database.ErrCommentsDisabled, CodeCommentsDisabled},
+	{database.ErrInvalidCursor, CodeInvalidCursor},
+	{database.ErrValidation, CodeBadUserInput},
+	{database.ErrForbidden, CodeForbidden},
+}
+
+// ErrorPresenter sets extensions.code for domain errors. Anything else is an
+// internal failure: it's logged and replaced by a generic message so that
+// database details don't leak to clients.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			presented := graphql.DefaultErrorPresenter(ctx, err)
+			errcode.Set(presented, c.code)
+			return presented
+		}
+	}
+
+	// Errors produced by gqlgen itself are meant for the client as they are.
+	// Resolver errors reach the presenter wrapped into a gqlerror too, so only
+	// the innermost one counts.
+	var gqlErr *gqlerror.Error
+	for errors.As(err, &gqlErr) && gqlErr.Err != nil {
+		err = gqlErr.Err
+	}
+	if errors.As(err, &gqlErr) {
+		return graphql.DefaultErrorPresenter(ctx, err)
+	}
+
+	log.Printf("internal error at %v: %v", graphql.GetPath(ctx), err)
+	presented := &gqlerror.Error{
+		Message: "internal server error",
+		Path:    graphql.GetPath(ctx),
+	}
+	errcode.Set(presented, CodeInternal)
+	return presented
+}
@@ -0,0 +1,121 @@
+package graph
+
+import (
+	"context"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/database"
+	"ozon-GraphQL/internal/dataloader"
+	"time"
+)
+
+// loaderWait is how long a loader waits for the sibling fields of a tree level
+// before fetching them together.
+const loaderWait = 2 * time.Millisecond
+
+type loadersKey struct{}
+
+// Loaders batch the repository lookups of a single operation.
+type Loaders struct {
+	replies *dataloader.Loader[repliesKey, *model.CommentConnection]
+}
+
+// repliesKey is a comparable copy of the replies field arguments.
+type repliesKey struct {
+	commentID      string
+	limit          int
+	after, before  string
+	backward       bool
+	order          model.SortOrder
+	withTotalCount bool
+}
+
+func newRepliesKey(commentID string, page database.Page) repliesKey {
+	key := repliesKey{
+		commentID:      commentID,
+		limit:          page.Limit,
+		backward:       page.Backward,
+		order:          page.Order,
+		withTotalCount: page.WithTotalCount,
+	}
+	if page.After != nil {
+		key.after = *page.After
+	}
+	if page.Before != nil {
+		key.before = *page.Before
+	}
+	return key
+}
+
+func (k repliesKey) page() database.Page {
+	page := database.Page{
+		Limit:          k.limit,
+		Backward:       k.backward,
+		Order:          k.order,
+		WithTotalCount: k.withTotalCount,
+	}
+	if k.after != "" {
+		page.After = &k.after
+	}
+	if k.before != "" {
+		page.Before = &k.before
+	}
+	return page
+}
+
+func NewLoaders(repo database.Repository) *Loaders {
+	return &Loaders{
+		replies: dataloader.New(loaderWait, func(ctx context.Context, keys []repliesKey) (map[repliesKey]*model.CommentConnection, error) {
+			return loadReplies(ctx, repo, keys)
+		}),
+	}
+}
+
+// loadReplies fetches the replies of all comments that share the same field
+// arguments with one repository call. Cursors point into a single comment's
+// replies, so keys with cursors are loaded one by one.
+func loadReplies(ctx context.Context, repo database.Repository, keys []repliesKey) (map[repliesKey]*model.CommentConnection, error) {
+	replies := make(map[repliesKey]*model.CommentConnection, len(keys))
+
+	batches := make(map[repliesKey][]string)
+	for _, key := range keys {
+		if key.after != "" || key.before != "" {
+			conn, err := repo.GetRepliesByCommentID(ctx, key.commentID, key.page())
+			if err != nil {
+				return nil, err
+			}
+			replies[key] = conn
+			continue
+		}
+
+		args := key
+		args.commentID = ""
+		batches[args] = append(batches[args], key.commentID)
+	}
+
+	for args, commentIDs := range batches {
+		conns, err := repo.GetRepliesByCommentIDs(ctx, commentIDs, args.page())
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range commentIDs {
+			key := args
+			key.commentID = id
+			replies[key] = conns[id]
+		}
+	}
+
+	return replies, nil
+}
+
+// WithLoaders attaches a fresh set of loaders to the context of an operation.
+func WithLoaders(ctx context.Context, repo database.Repository) context.Context {
+	return context.WithValue(ctx, loadersKey{}, NewLoaders(repo))
+}
+
+func (r *Resolver) loadReplies(ctx context.Context, commentID string, page database.Page) (*model.CommentConnection, error) {
+	loaders, ok := ctx.Value(loadersKey{}).(*Loaders)
+	if !ok {
+		return r.Repo.GetRepliesByCommentID(ctx, commentID, page)
+	}
+	return loaders.replies.Load(ctx, newRepliesKey(commentID, page))
+}
@@ -2,6 +2,12 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
 type Comment struct {
 	ID        string             `json:"id"`
 	AuthorID  string             `json:"authorId"`
@@ -9,12 +15,16 @@ type Comment struct {
 	ParentID  *string            `json:"parentId,omitempty"`
 	Content   string             `json:"content"`
 	CreatedAt string             `json:"createdAt"`
+	EditedAt  *string            `json:"editedAt,omitempty"`
+	DeletedAt *string            `json:"deletedAt,omitempty"`
+	Locked    bool               `json:"locked"`
 	Replies   *CommentConnection `json:"replies"`
 }
 
 type CommentConnection struct {
-	Edges    []*CommentEdge `json:"edges"`
-	PageInfo *PageInfo      `json:"pageInfo"`
+	Edges      []*CommentEdge `json:"edges"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+	TotalCount *int32         `json:"totalCount,omitempty"`
 }
 
 type CommentEdge struct {
@@ -26,21 +36,27 @@ type Mutation struct {
 }
 
 type PageInfo struct {
-	EndCursor   *string `json:"endCursor,omitempty"`
-	HasNextPage bool    `json:"hasNextPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	HasNextPage     bool    `json:"hasNextPage"`
 }
 
 type Post struct {
-	ID            string `json:"id"`
-	AuthorID      string `json:"authorId"`
-	Title         string `json:"title"`
-	Content       string `json:"content"`
-	AllowComments bool   `json:"allowComments"`
+	ID            string  `json:"id"`
+	AuthorID      string  `json:"authorId"`
+	Title         string  `json:"title"`
+	Content       string  `json:"content"`
+	AllowComments bool    `json:"allowComments"`
+	CreatedAt     string  `json:"createdAt"`
+	EditedAt      *string `json:"editedAt,omitempty"`
+	DeletedAt     *string `json:"deletedAt,omitempty"`
 }
 
 type PostConnection struct {
-	Edges    []*PostEdge `json:"edges"`
-	PageInfo *PageInfo   `json:"pageInfo"`
+	Edges      []*PostEdge `json:"edges"`
+	PageInfo   *PageInfo   `json:"pageInfo"`
+	TotalCount *int32      `json:"totalCount,omitempty"`
 }
 
 type PostEdge struct {
@@ -53,3 +69,66 @@ type Query struct {
 
 type Subscription struct {
 }
+
+type ThreadComment struct {
+	Comment *Comment `json:"comment"`
+	Depth   int32    `json:"depth"`
+	// Set when the comment has replies below maxDepth. They are left out of the
+	// thread and can be loaded through Comment.replies.
+	ContinueThread bool `json:"continueThread"`
+}
+
+type ThreadConnection struct {
+	Edges    []*ThreadEdge `json:"edges"`
+	PageInfo *PageInfo     `json:"pageInfo"`
+}
+
+type ThreadEdge struct {
+	Cursor string         `json:"cursor"`
+	Node   *ThreadComment `json:"node"`
+}
+
+// MOST_REPLIES sorts posts by their number of comments and comments by their
+// number of direct replies, newest first among equals.
+type SortOrder string
+
+const (
+	SortOrderNewest      SortOrder = "NEWEST"
+	SortOrderOldest      SortOrder = "OLDEST"
+	SortOrderMostReplies SortOrder = "MOST_REPLIES"
+)
+
+var AllSortOrder = []SortOrder{
+	SortOrderNewest,
+	SortOrderOldest,
+	SortOrderMostReplies,
+}
+
+func (e SortOrder) IsValid() bool {
+	switch e {
+	case SortOrderNewest, SortOrderOldest, SortOrderMostReplies:
+		return true
+	}
+	return false
+}
+
+func (e SortOrder) String() string {
+	return string(e)
+}
+
+func (e *SortOrder) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SortOrder(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SortOrder", str)
+	}
+	return nil
+}
+
+func (e SortOrder) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,81 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"github.com/99designs/gqlgen/graphql"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/database"
+)
+
+// PagePolicy bounds the page size of every connection field.
+type PagePolicy struct {
+	// DefaultSize is used when neither first nor last is given.
+	DefaultSize int
+	MaxSize     int
+}
+
+func DefaultPagePolicy() PagePolicy {
+	return PagePolicy{DefaultSize: 10, MaxSize: 100}
+}
+
+// size returns the requested page size or an error when it's out of bounds.
+func (p PagePolicy) size(arg string, value *int32) (int, error) {
+	if value == nil {
+		return p.DefaultSize, nil
+	}
+	if *value <= 0 {
+		return 0, badUserInput("%s must be positive", arg)
+	}
+	if int(*value) > p.MaxSize {
+		return 0, badUserInput("%s must not exceed %d", arg, p.MaxSize)
+	}
+	return int(*value), nil
+}
+
+func badUserInput(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", database.ErrValidation, fmt.Sprintf(format, args...))
+}
+
+// newPage turns Relay connection arguments into a repository page.
+func (r *Resolver) newPage(ctx context.Context, first *int32, after *string, last *int32, before *string, orderBy *model.SortOrder) (database.Page, error) {
+	if first != nil && last != nil {
+		return database.Page{}, badUserInput("first and last can't be used together")
+	}
+
+	page := database.Page{
+		After:          after,
+		Before:         before,
+		WithTotalCount: selected(ctx, "totalCount"),
+	}
+
+	var err error
+	if last != nil {
+		page.Limit, err = r.Pagination.size("last", last)
+		page.Backward = true
+	} else {
+		page.Limit, err = r.Pagination.size("first", first)
+	}
+	if err != nil {
+		return database.Page{}, err
+	}
+
+	if orderBy != nil {
+		page.Order = *orderBy
+	}
+
+	return page, nil
+}
+
+// selected reports whether the field being resolved selects the named subfield.
+func selected(ctx context.Context, name string) bool {
+	if graphql.GetFieldContext(ctx) == nil {
+		return false
+	}
+	for _, field := range graphql.CollectFieldsCtx(ctx, nil) {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
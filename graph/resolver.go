@@ -3,7 +3,7 @@ package graph
 import (
 	"ozon-GraphQL/graph/model"
 	"ozon-GraphQL/internal/database"
-	"sync"
+	"ozon-GraphQL/internal/pubsub"
 )
 
 // This file will not be regenerated automatically.
@@ -11,14 +11,19 @@ import (
 // It serves as dependency injection for your app, add any dependencies you require here.
 
 type Resolver struct {
-	Repo             database.Repository
-	CommentObservers map[string]chan *model.Comment
-	mu               sync.Mutex
+	Repo     database.Repository
+	Comments pubsub.Broker[*model.Comment]
+	Posts    pubsub.Broker[*model.Post]
+
+	Pagination PagePolicy
 }
 
-func NewResolver(Repo database.Repository) *Resolver {
+func NewResolver(Repo database.Repository, Comments pubsub.Broker[*model.Comment], Posts pubsub.Broker[*model.Post]) *Resolver {
 	return &Resolver{
-		Repo:             Repo,
-		CommentObservers: make(map[string]chan *model.Comment),
+		Repo:     Repo,
+		Comments: Comments,
+		Posts:    Posts,
+
+		Pagination: DefaultPagePolicy(),
 	}
 }
@@ -7,88 +7,223 @@ package graph
 import (
 	"context"
 	"fmt"
+	"log"
 	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/database"
 )
 
+// Replies is the resolver for the replies field.
+func (r *commentResolver) Replies(ctx context.Context, obj *model.Comment, first *int32, after *string, last *int32, before *string, orderBy *model.SortOrder) (*model.CommentConnection, error) {
+	page, err := r.newPage(ctx, first, after, last, before, orderBy)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.loadReplies(ctx, obj.ID, page)
+}
+
 // CreatePost is the resolver for the createPost field.
 func (r *mutationResolver) CreatePost(ctx context.Context, authorID string, title string, content string, allowComments bool) (*model.Post, error) {
-	post, err := r.Repo.CreatePost(authorID, title, content, allowComments)
+	post, err := r.Repo.CreatePost(ctx, authorID, title, content, allowComments)
 	if err != nil {
 		return nil, err
 	}
+
+	r.publishPost(ctx, post)
+
 	return post, nil
 }
 
 // CreateComment is the resolver for the createComment field.
 func (r *mutationResolver) CreateComment(ctx context.Context, authorID string, postID string, content string) (*model.Comment, error) {
-	post, err := r.Repo.GetPostByID(postID)
+	post, err := r.Repo.GetPostByID(ctx, postID)
 	if err != nil {
-		return nil, fmt.Errorf("post not found: %v", err)
+		return nil, err
 	}
 
 	if !post.AllowComments {
-		return nil, fmt.Errorf("comments are not allowed for this post")
+		return nil, fmt.Errorf("%w for this post", database.ErrCommentsDisabled)
 	}
 
 	if len(content) > 2000 {
-		return nil, fmt.Errorf("content too long")
+		return nil, fmt.Errorf("%w: content too long", database.ErrValidation)
 	}
 
-	comment, err := r.Repo.CreateComment(authorID, postID, content)
+	comment, err := r.Repo.CreateComment(ctx, authorID, postID, content)
 	if err != nil {
 		return nil, err
 	}
 
-	go func() {
-		r.mu.Lock()
-		defer r.mu.Unlock()
-		if ch, ok := r.CommentObservers[postID]; ok {
-			ch <- comment
-		}
-	}()
+	r.publishComment(ctx, comment, nil)
 
 	return comment, nil
 }
 
 // CreateReply is the resolver for the createReply field.
 func (r *mutationResolver) CreateReply(ctx context.Context, authorID string, postID string, parentID string, content string) (*model.Comment, error) {
-	post, err := r.Repo.GetPostByID(postID)
+	post, err := r.Repo.GetPostByID(ctx, postID)
 	if err != nil {
-		return nil, fmt.Errorf("post not found: %v", err)
+		return nil, err
 	}
 
 	if !post.AllowComments {
-		return nil, fmt.Errorf("comments are not allowed for this post")
+		return nil, fmt.Errorf("%w for this post", database.ErrCommentsDisabled)
+	}
+
+	if len(content) > 2000 {
+		return nil, fmt.Errorf("%w: content too long", database.ErrValidation)
+	}
+
+	thread, err := r.Repo.GetCommentAncestors(ctx, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("parent %w", err)
+	}
+
+	for _, parent := range thread {
+		if parent.Locked {
+			return nil, fmt.Errorf("%w: thread is locked", database.ErrCommentsDisabled)
+		}
+	}
+
+	comment, err := r.Repo.CreateReply(ctx, authorID, postID, content, &parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.publishComment(ctx, comment, thread)
+
+	return comment, nil
+}
+
+// UpdatePost is the resolver for the updatePost field.
+func (r *mutationResolver) UpdatePost(ctx context.Context, id string, authorID string, title *string, content *string) (*model.Post, error) {
+	post, err := r.Repo.GetPostByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.AuthorID != authorID {
+		return nil, fmt.Errorf("%w: only the author can edit this post", database.ErrForbidden)
+	}
+
+	return r.Repo.UpdatePost(ctx, id, title, content)
+}
+
+// DeletePost is the resolver for the deletePost field.
+func (r *mutationResolver) DeletePost(ctx context.Context, id string, authorID string) (*model.Post, error) {
+	post, err := r.Repo.GetPostByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.AuthorID != authorID {
+		return nil, fmt.Errorf("%w: only the author can delete this post", database.ErrForbidden)
+	}
+
+	return r.Repo.DeletePost(ctx, id)
+}
+
+// UpdateComment is the resolver for the updateComment field.
+func (r *mutationResolver) UpdateComment(ctx context.Context, id string, authorID string, content string) (*model.Comment, error) {
+	comment, err := r.Repo.GetCommentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.AuthorID != authorID {
+		return nil, fmt.Errorf("%w: only the author can edit this comment", database.ErrForbidden)
+	}
+
+	if comment.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: comment is deleted", database.ErrValidation)
 	}
 
 	if len(content) > 2000 {
-		return nil, fmt.Errorf("content too long")
+		return nil, fmt.Errorf("%w: content too long", database.ErrValidation)
 	}
 
-	comment, err := r.Repo.CreateReply(authorID, postID, content, &parentID)
+	return r.Repo.UpdateComment(ctx, id, content)
+}
+
+// DeleteComment is the resolver for the deleteComment field.
+func (r *mutationResolver) DeleteComment(ctx context.Context, id string, authorID string) (*model.Comment, error) {
+	comment, err := r.Repo.GetCommentByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 
-	go func() {
-		r.mu.Lock()
-		defer r.mu.Unlock()
-		if ch, ok := r.CommentObservers[postID]; ok {
-			ch <- comment
+	if comment.AuthorID != authorID {
+		return nil, fmt.Errorf("%w: only the author can delete this comment", database.ErrForbidden)
+	}
+
+	if comment.DeletedAt != nil {
+		return nil, fmt.Errorf("%w: comment is deleted", database.ErrValidation)
+	}
+
+	return r.Repo.DeleteComment(ctx, id)
+}
+
+// SetPostCommentsEnabled is the resolver for the setPostCommentsEnabled field.
+func (r *mutationResolver) SetPostCommentsEnabled(ctx context.Context, postID string, authorID string, enabled bool) (*model.Post, error) {
+	post, err := r.Repo.GetPostByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.AuthorID != authorID {
+		return nil, fmt.Errorf("%w: only the author can change comment settings of this post", database.ErrForbidden)
+	}
+
+	post, err = r.Repo.SetPostCommentsEnabled(ctx, postID, enabled)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enabled {
+		if err := r.Comments.Close(ctx, postTopic(postID)); err != nil {
+			log.Printf("failed to close subscriptions of post %s: %v", postID, err)
 		}
-	}()
+	}
+
+	return post, nil
+}
+
+// LockThread is the resolver for the lockThread field.
+func (r *mutationResolver) LockThread(ctx context.Context, commentID string, authorID string) (*model.Comment, error) {
+	comment, err := r.Repo.GetCommentByID(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := r.Repo.GetPostByID(ctx, comment.PostID)
+	if err != nil {
+		return nil, err
+	}
+
+	if post.AuthorID != authorID {
+		return nil, fmt.Errorf("%w: only the author of the post can lock its threads", database.ErrForbidden)
+	}
+
+	comment, err = r.Repo.LockThread(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.Comments.Publish(ctx, comment, postTopic(comment.PostID)); err != nil {
+		log.Printf("failed to publish locked comment %s: %v", comment.ID, err)
+	}
 
 	return comment, nil
 }
 
 // Posts is the resolver for the posts field.
-func (r *queryResolver) Posts(ctx context.Context, first *int32, after *string) (*model.PostConnection, error) {
-	limit := 10
-	if first != nil {
-		limit = int(*first) // Преобразуем int32 в int
+func (r *queryResolver) Posts(ctx context.Context, first *int32, after *string, last *int32, before *string, orderBy *model.SortOrder) (*model.PostConnection, error) {
+	page, err := r.newPage(ctx, first, after, last, before, orderBy)
+	if err != nil {
+		return nil, err
 	}
 
-	postConnection, err := r.Repo.GetPosts(limit, after)
+	postConnection, err := r.Repo.GetPosts(ctx, page)
 	if err != nil {
 		return nil, err
 	}
@@ -98,112 +233,86 @@ func (r *queryResolver) Posts(ctx context.Context, first *int32, after *string)
 
 // Post is the resolver for the post field.
 func (r *queryResolver) Post(ctx context.Context, id string) (*model.Post, error) {
-	post, err := r.Repo.GetPostByID(id)
+	post, err := r.Repo.GetPostByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
 	return post, nil
 }
 
-// Recursively load comments with nested replies
-func (r *queryResolver) loadNestedComments(ctx context.Context, comment *model.Comment, limit int) error {
-	replies, err := r.Repo.GetRepliesByCommentID(comment.ID, limit, nil)
-	if err != nil {
-		return err
-	}
-
-	if replies != nil && len(replies.Edges) > 0 {
-		replyEdges := make([]*model.CommentEdge, len(replies.Edges))
-		for j, replyEdge := range replies.Edges {
-			replyEdges[j] = &model.CommentEdge{
-				Cursor: replyEdge.Cursor,
-				Node: &model.Comment{
-					ID:        replyEdge.Node.ID,
-					AuthorID:  replyEdge.Node.AuthorID,
-					PostID:    replyEdge.Node.PostID,
-					ParentID:  replyEdge.Node.ParentID,
-					Content:   replyEdge.Node.Content,
-					CreatedAt: replyEdge.Node.CreatedAt,
-				},
-			}
-
-			// Recursively load nested replies
-			if err := r.loadNestedComments(ctx, replyEdges[j].Node, limit); err != nil {
-				return err
-			}
-		}
-
-		comment.Replies = &model.CommentConnection{
-			Edges:    replyEdges,
-			PageInfo: replies.PageInfo,
-		}
-	} else {
-		comment.Replies = &model.CommentConnection{
-			Edges:    []*model.CommentEdge{},
-			PageInfo: &model.PageInfo{HasNextPage: false},
-		}
-	}
-	return nil
-}
-
 // Comments is the resolver for the comments field.
-func (r *queryResolver) Comments(ctx context.Context, postID string, first *int32, after *string) (*model.CommentConnection, error) {
-	limit := 10
-	if first != nil {
-		limit = int(*first)
+func (r *queryResolver) Comments(ctx context.Context, postID string, first *int32, after *string, last *int32, before *string, orderBy *model.SortOrder) (*model.CommentConnection, error) {
+	page, err := r.newPage(ctx, first, after, last, before, orderBy)
+	if err != nil {
+		return nil, err
 	}
 
-	comments, err := r.Repo.GetComments(postID, limit, after)
+	comments, err := r.Repo.GetComments(ctx, postID, page)
 	if err != nil {
 		return nil, err
 	}
 
-	commentEdges := make([]*model.CommentEdge, len(comments.Edges))
-	for i, edge := range comments.Edges {
-		commentEdges[i] = &model.CommentEdge{
-			Cursor: edge.Cursor,
-			Node: &model.Comment{
-				ID:        edge.Node.ID,
-				AuthorID:  edge.Node.AuthorID,
-				PostID:    edge.Node.PostID,
-				ParentID:  edge.Node.ParentID,
-				Content:   edge.Node.Content,
-				CreatedAt: edge.Node.CreatedAt,
-			},
-		}
+	return comments, nil
+}
 
-		// Recursively load nested replies
-		if err := r.loadNestedComments(ctx, commentEdges[i].Node, limit); err != nil {
-			return nil, err
-		}
+// CommentThread is the resolver for the commentThread field.
+func (r *queryResolver) CommentThread(ctx context.Context, postID string, maxDepth *int32, first *int32, after *string) (*model.ThreadConnection, error) {
+	page, err := r.newPage(ctx, first, after, nil, nil, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	commentConnection := &model.CommentConnection{
-		Edges:    commentEdges,
-		PageInfo: comments.PageInfo,
+	var depth *int
+	if maxDepth != nil {
+		if *maxDepth < 0 {
+			return nil, badUserInput("maxDepth must not be negative")
+		}
+		d := int(*maxDepth)
+		depth = &d
 	}
 
-	return commentConnection, nil
+	return r.Repo.GetCommentThread(ctx, postID, depth, page)
 }
 
 // CommentAdded is the resolver for the commentAdded field.
-func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string) (<-chan *model.Comment, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID string, since *string) (<-chan *model.Comment, error) {
+	sub := r.Comments.Subscribe(postTopic(postID))
+
+	if since != nil {
+		after, err := r.sinceCursor(ctx, *since)
+		if err != nil {
+			sub.Unsubscribe()
+			return nil, err
+		}
+		page, err := r.commentsAfter(ctx, postID, &after)
+		if err != nil {
+			sub.Unsubscribe()
+			return nil, err
+		}
+		return r.replay(ctx, postID, page, sub), nil
+	}
 
-	ch := make(chan *model.Comment, 1)
-	r.CommentObservers[postID] = ch
+	return watch(ctx, sub), nil
+}
 
-	go func() {
-		<-ctx.Done()
-		r.mu.Lock()
-		defer r.mu.Unlock()
-		delete(r.CommentObservers, postID)
-	}()
+// ReplyAdded is the resolver for the replyAdded field.
+func (r *subscriptionResolver) ReplyAdded(ctx context.Context, commentID string) (<-chan *model.Comment, error) {
+	return watch(ctx, r.Comments.Subscribe(threadTopic(commentID))), nil
+}
 
-	return ch, nil
+// CommentAddedByAuthor is the resolver for the commentAddedByAuthor field.
+func (r *subscriptionResolver) CommentAddedByAuthor(ctx context.Context, authorID string) (<-chan *model.Comment, error) {
+	return watch(ctx, r.Comments.Subscribe(authorTopic(authorID))), nil
 }
 
+// PostCreated is the resolver for the postCreated field.
+func (r *subscriptionResolver) PostCreated(ctx context.Context) (<-chan *model.Post, error) {
+	return watch(ctx, r.Posts.Subscribe(postsTopic)), nil
+}
+
+// Comment returns CommentResolver implementation.
+func (r *Resolver) Comment() CommentResolver { return &commentResolver{r} }
+
 // Mutation returns MutationResolver implementation.
 func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
 
@@ -213,6 +322,7 @@ func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
 // Subscription returns SubscriptionResolver implementation.
 func (r *Resolver) Subscription() SubscriptionResolver { return &subscriptionResolver{r} }
 
+type commentResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
 type subscriptionResolver struct{ *Resolver }
@@ -0,0 +1,189 @@
+package graph
+
+import (
+	"context"
+	"log"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/cursor"
+	"ozon-GraphQL/internal/database"
+	"ozon-GraphQL/internal/pubsub"
+)
+
+const replayPageSize = 100
+
+const postsTopic = "posts"
+
+func postTopic(postID string) string {
+	return "post:" + postID
+}
+
+func threadTopic(commentID string) string {
+	return "thread:" + commentID
+}
+
+func authorTopic(authorID string) string {
+	return "author:" + authorID
+}
+
+// publishComment notifies subscribers of the post, of the author and of every
+// thread the comment is nested in. thread is the comment's parent followed by
+// all of its ancestors, as CreateReply has loaded them already.
+func (r *Resolver) publishComment(ctx context.Context, comment *model.Comment, thread []*model.Comment) {
+	topics := []string{postTopic(comment.PostID), authorTopic(comment.AuthorID)}
+	for _, parent := range thread {
+		topics = append(topics, threadTopic(parent.ID))
+	}
+
+	if err := r.Comments.Publish(ctx, comment, topics...); err != nil {
+		log.Printf("failed to publish comment %s: %v", comment.ID, err)
+	}
+}
+
+func (r *Resolver) publishPost(ctx context.Context, post *model.Post) {
+	if err := r.Posts.Publish(ctx, post, postsTopic); err != nil {
+		log.Printf("failed to publish post %s: %v", post.ID, err)
+	}
+}
+
+// watch hands the subscription channel to gqlgen and unsubscribes once the
+// client goes away.
+func watch[T any](ctx context.Context, sub *pubsub.Subscription[T]) <-chan T {
+	go func() {
+		<-ctx.Done()
+		sub.Unsubscribe()
+	}()
+
+	return sub.C()
+}
+
+// sinceCursor turns since, which is either a comments cursor or the ID of
+// the last comment the client has seen, into a cursor: comments delivered by
+// the subscription carry no cursor.
+func (r *Resolver) sinceCursor(ctx context.Context, since string) (string, error) {
+	if _, err := cursor.Decode(since); err == nil {
+		return since, nil
+	}
+
+	comment, err := r.Repo.GetCommentByID(ctx, since)
+	if err != nil {
+		return "", database.ErrInvalidCursor
+	}
+	return cursor.EncodeRow(comment.CreatedAt, comment.ID), nil
+}
+
+// commentsAfter loads the next page of persisted comments to replay.
+func (r *Resolver) commentsAfter(ctx context.Context, postID string, after *string) (*model.CommentConnection, error) {
+	return r.Repo.GetPostComments(ctx, postID, database.Page{Limit: replayPageSize, After: after})
+}
+
+// replay streams the persisted comments of the post page by page, starting
+// with page, and then switches to the live subscription. The subscription is
+// opened before the replay is loaded and drained into a queue while the
+// replay is sent, so nothing created in between is lost; comments that show
+// up in both are delivered once. The queue holds as many comments as the
+// subscription's buffer, and a subscriber that falls further behind is
+// handled by the broker's slow consumer policy.
+func (r *Resolver) replay(ctx context.Context, postID string, page *model.CommentConnection, sub *pubsub.Subscription[*model.Comment]) <-chan *model.Comment {
+	out := make(chan *model.Comment)
+	opts := r.Comments.Options()
+
+	go func() {
+		defer close(out)
+		defer sub.Unsubscribe()
+
+		var queue []*model.Comment
+		open := true
+		stop := make(chan struct{})
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for {
+				select {
+				case comment, ok := <-sub.C():
+					if !ok {
+						open = false
+						return
+					}
+					if len(queue) < opts.BufferSize {
+						queue = append(queue, comment)
+					} else if opts.Policy == pubsub.Disconnect {
+						sub.Unsubscribe()
+						open = false
+						return
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+		stopDraining := func() {
+			if stop != nil {
+				close(stop)
+				<-drained
+				stop = nil
+			}
+		}
+		defer stopDraining()
+
+		send := func(comment *model.Comment) bool {
+			select {
+			case out <- comment:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		seen := make(map[string]struct{})
+		for {
+			for _, edge := range page.Edges {
+				seen[edge.Node.ID] = struct{}{}
+				if !send(edge.Node) {
+					return
+				}
+			}
+			if !page.PageInfo.HasNextPage || page.PageInfo.EndCursor == nil {
+				break
+			}
+
+			var err error
+			page, err = r.commentsAfter(ctx, postID, page.PageInfo.EndCursor)
+			if err != nil {
+				log.Printf("failed to replay comments of post %s: %v", postID, err)
+				return
+			}
+		}
+
+		// A locked comment is a notification about an existing comment, not
+		// a duplicate of a replayed one.
+		forward := func(comment *model.Comment) bool {
+			if _, ok := seen[comment.ID]; ok && !comment.Locked {
+				return true
+			}
+			return send(comment)
+		}
+
+		stopDraining()
+		for _, comment := range queue {
+			if !forward(comment) {
+				return
+			}
+		}
+		if !open {
+			return
+		}
+
+		for {
+			select {
+			case comment, ok := <-sub.C():
+				if !ok || !forward(comment) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
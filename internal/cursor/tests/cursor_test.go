@@ -0,0 +1,48 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"ozon-GraphQL/internal/cursor"
+	"testing"
+	"time"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	codec := cursor.NewCodec(nil)
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 123456000, time.UTC)
+
+	token := codec.Encode(cursor.Cursor{CreatedAt: createdAt, ID: "42"})
+	cur, err := codec.Decode(token)
+
+	assert.NoError(t, err)
+	assert.Equal(t, cursor.Version, cur.Version)
+	assert.True(t, createdAt.Equal(cur.CreatedAt))
+	assert.Equal(t, "42", cur.ID)
+	assert.NotContains(t, token, "42")
+}
+
+func TestCodecRejectsGarbage(t *testing.T) {
+	codec := cursor.NewCodec(nil)
+
+	for _, token := range []string{"", "42", "!!!", "e30"} {
+		_, err := codec.Decode(token)
+		assert.ErrorIs(t, err, cursor.ErrInvalidCursor, token)
+	}
+}
+
+func TestSignedCodecRejectsForgedCursor(t *testing.T) {
+	signed := cursor.NewCodec([]byte("secret"))
+	unsigned := cursor.NewCodec(nil)
+	other := cursor.NewCodec([]byte("other"))
+
+	token := signed.Encode(cursor.Cursor{CreatedAt: time.Now(), ID: "42"})
+
+	_, err := signed.Decode(token)
+	assert.NoError(t, err)
+
+	_, err = signed.Decode(unsigned.Encode(cursor.Cursor{CreatedAt: time.Now(), ID: "42"}))
+	assert.ErrorIs(t, err, cursor.ErrInvalidCursor)
+
+	_, err = other.Decode(token)
+	assert.ErrorIs(t, err, cursor.ErrInvalidCursor)
+}
@@ -1,15 +1,48 @@
 package database
 
+//go:generate mockgen -source=database.go -destination=storage/mocks/mock_database.go -package=mocks
+
 import (
 	"context"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 )
 
-type Database interface {
+type Querier interface {
+	Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error)
 	Query(ctx context.Context, query string, args ...interface{}) (pgx.Rows, error)
 	QueryRow(ctx context.Context, query string, args ...interface{}) pgx.Row
 }
 
+// Database is implemented by *Pool.
+type Database interface {
+	Querier
+	Begin(ctx context.Context) (Tx, error)
+}
+
+type Tx interface {
+	Querier
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// WithTx runs fn in a transaction that is committed when fn succeeds and
+// rolled back otherwise.
+func WithTx(ctx context.Context, db Database, fn func(tx Tx) error) error {
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		// ctx may already be done. If the rollback fails anyway, pgx closes
+		// the connection, which aborts the transaction as well.
+		_ = tx.Rollback(context.Background())
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 type Rows interface {
 	Next() bool
 	Scan(dest ...interface{}) error
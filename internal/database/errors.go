@@ -0,0 +1,16 @@
+package database
+
+import (
+	"errors"
+	"ozon-GraphQL/internal/cursor"
+)
+
+// Repositories and resolvers wrap these errors, so callers can tell them
+// apart with errors.Is instead of matching messages.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrCommentsDisabled = errors.New("comments are disabled")
+	ErrInvalidCursor    = cursor.ErrInvalidCursor
+	ErrValidation       = errors.New("invalid input")
+	ErrForbidden        = errors.New("forbidden")
+)
@@ -0,0 +1,17 @@
+package database
+
+import "ozon-GraphQL/graph/model"
+
+// Page selects a window of a connection. Rows are taken from the range between
+// After and Before: the first Limit of them, or the last Limit when Backward
+// is set.
+type Page struct {
+	Limit    int
+	After    *string
+	Before   *string
+	Backward bool
+	// Order defaults to model.SortOrderOldest.
+	Order model.SortOrder
+	// WithTotalCount asks for the number of rows in the whole connection.
+	WithTotalCount bool
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"time"
+)
+
+// PoolConfig overrides the pgxpool defaults; zero values keep them.
+type PoolConfig struct {
+	MinConns          int32
+	MaxConns          int32
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+}
+
+func NewPoolConfig(connStr string, cfg PoolConfig) (*pgxpool.Config, error) {
+	poolCfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+
+	if poolCfg.MinConns > poolCfg.MaxConns {
+		return nil, errors.New("min connections must not exceed max connections")
+	}
+	return poolCfg, nil
+}
+
+// Pool adapts *pgxpool.Pool to Database.
+type Pool struct {
+	*pgxpool.Pool
+}
+
+var _ Database = (*Pool)(nil)
+
+func NewPool(ctx context.Context, connStr string, cfg PoolConfig) (*Pool, error) {
+	poolCfg, err := NewPoolConfig(connStr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := pgxpool.ConnectConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Pool{Pool: pool}, nil
+}
+
+func (p *Pool) Begin(ctx context.Context) (Tx, error) {
+	return p.Pool.Begin(ctx)
+}
+
+type PoolStats struct {
+	MaxConns                int32         `json:"maxConns"`
+	TotalConns              int32         `json:"totalConns"`
+	AcquiredConns           int32         `json:"acquiredConns"`
+	IdleConns               int32         `json:"idleConns"`
+	ConstructingConns       int32         `json:"constructingConns"`
+	AcquireCount            int64         `json:"acquireCount"`
+	CanceledAcquireCount    int64         `json:"canceledAcquireCount"`
+	EmptyAcquireCount       int64         `json:"emptyAcquireCount"`
+	AcquireDuration         time.Duration `json:"acquireDurationNs"`
+	NewConnsCount           int64         `json:"newConnsCount"`
+	MaxIdleDestroyCount     int64         `json:"maxIdleDestroyCount"`
+	MaxLifetimeDestroyCount int64         `json:"maxLifetimeDestroyCount"`
+}
+
+func Stats(pool *Pool) PoolStats {
+	s := pool.Stat()
+	return PoolStats{
+		MaxConns:                s.MaxConns(),
+		TotalConns:              s.TotalConns(),
+		AcquiredConns:           s.AcquiredConns(),
+		IdleConns:               s.IdleConns(),
+		ConstructingConns:       s.ConstructingConns(),
+		AcquireCount:            s.AcquireCount(),
+		CanceledAcquireCount:    s.CanceledAcquireCount(),
+		EmptyAcquireCount:       s.EmptyAcquireCount(),
+		AcquireDuration:         s.AcquireDuration(),
+		NewConnsCount:           s.NewConnsCount(),
+		MaxIdleDestroyCount:     s.MaxIdleDestroyCount(),
+		MaxLifetimeDestroyCount: s.MaxLifetimeDestroyCount(),
+	}
+}
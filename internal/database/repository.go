@@ -1,13 +1,42 @@
 package database
 
-import "ozon-GraphQL/graph/model"
+import (
+	"context"
+	"ozon-GraphQL/graph/model"
+)
 
 type Repository interface {
-	CreatePost(authorID, title, content string, allowComments bool) (*model.Post, error)
-	GetPosts(limit int, after *string) (*model.PostConnection, error)
-	GetPostByID(id string) (*model.Post, error)
-	CreateComment(authorID, postID string, content string) (*model.Comment, error)
-	GetComments(postID string, limit int, after *string) (*model.CommentConnection, error)
-	CreateReply(authorID, postID string, content string, parentID *string) (*model.Comment, error)
-	GetRepliesByCommentID(commentID string, limit int, after *string) (*model.CommentConnection, error)
+	CreatePost(ctx context.Context, authorID, title, content string, allowComments bool) (*model.Post, error)
+	GetPosts(ctx context.Context, page Page) (*model.PostConnection, error)
+	GetPostByID(ctx context.Context, id string) (*model.Post, error)
+	UpdatePost(ctx context.Context, id string, title, content *string) (*model.Post, error)
+	DeletePost(ctx context.Context, id string) (*model.Post, error)
+	SetPostCommentsEnabled(ctx context.Context, id string, enabled bool) (*model.Post, error)
+	CreateComment(ctx context.Context, authorID, postID string, content string) (*model.Comment, error)
+	GetCommentByID(ctx context.Context, id string) (*model.Comment, error)
+	// GetComments lists the root comments of the post. Replies are only
+	// reachable through GetRepliesByCommentID.
+	GetComments(ctx context.Context, postID string, page Page) (*model.CommentConnection, error)
+	// GetPostComments lists every comment of the post, replies included.
+	GetPostComments(ctx context.Context, postID string, page Page) (*model.CommentConnection, error)
+	CreateReply(ctx context.Context, authorID, postID string, content string, parentID *string) (*model.Comment, error)
+	GetRepliesByCommentID(ctx context.Context, commentID string, page Page) (*model.CommentConnection, error)
+	// GetRepliesByCommentIDs applies page to the replies of every comment at
+	// once and returns a connection for each of them. page can't have cursors.
+	GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, page Page) (map[string]*model.CommentConnection, error)
+	// GetCommentSubtree returns the comment followed by all of its descendants
+	// in threaded display order: depth-first, siblings oldest first.
+	GetCommentSubtree(ctx context.Context, commentID string) ([]*model.Comment, error)
+	// GetCommentAncestors returns the comment followed by its parent, the
+	// parent's parent and so on up to the root comment, in one round trip.
+	GetCommentAncestors(ctx context.Context, commentID string) ([]*model.Comment, error)
+	// GetCommentThread lists all comments of the post the way GetCommentSubtree
+	// orders a single thread. Comments deeper than maxDepth are left out unless
+	// maxDepth is nil. page can only have a limit and an after cursor.
+	GetCommentThread(ctx context.Context, postID string, maxDepth *int, page Page) (*model.ThreadConnection, error)
+	UpdateComment(ctx context.Context, id, content string) (*model.Comment, error)
+	// DeleteComment removes a comment without replies and turns a comment with
+	// replies into a tombstone so the thread below it stays intact.
+	DeleteComment(ctx context.Context, id string) (*model.Comment, error)
+	LockThread(ctx context.Context, id string) (*model.Comment, error)
 }
@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/cursor"
+	"ozon-GraphQL/internal/database"
+	"slices"
+	"strings"
+	"time"
+)
+
+// deletedContent replaces the content of a deleted comment that still has replies.
+const deletedContent = "[deleted]"
+
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339Nano)
+	return &s
+}
+
+func sortOrder(page database.Page) model.SortOrder {
+	if page.Order == "" {
+		return model.SortOrderOldest
+	}
+	return page.Order
+}
+
+// rowKey is the position of a row in the given order. replies is the number
+// of comments of a post or of direct replies to a comment.
+func rowKey(createdAt, id string, replies int, order model.SortOrder) cursor.Cursor {
+	t, _ := time.Parse(time.RFC3339Nano, createdAt)
+	key := cursor.Cursor{Order: string(order), CreatedAt: t, ID: id}
+	if order == model.SortOrderMostReplies {
+		key.Replies = replies
+	}
+	return key
+}
+
+func postKey(post *model.Post, replies int, order model.SortOrder) cursor.Cursor {
+	return rowKey(post.CreatedAt, post.ID, replies, order)
+}
+
+func commentKey(comment *model.Comment, replies int, order model.SortOrder) cursor.Cursor {
+	return rowKey(comment.CreatedAt, comment.ID, replies, order)
+}
+
+// threadOrder is the order of cursors issued for threaded views.
+const threadOrder = "THREAD"
+
+// pathSegment mirrors comment_path_segment from the migrations: a comment's
+// path is its ancestors' segments followed by its own, joined by slashes.
+func pathSegment(createdAt, id string) string {
+	t, _ := time.Parse(time.RFC3339Nano, createdAt)
+	t = t.UTC()
+	return fmt.Sprintf("%s%06d-%s", t.Format("20060102150405"), t.Nanosecond()/1000, id)
+}
+
+func threadCursor(comment *model.Comment, path string) string {
+	t, _ := time.Parse(time.RFC3339Nano, comment.CreatedAt)
+	return cursor.Encode(cursor.Cursor{Order: threadOrder, Path: path, CreatedAt: t, ID: comment.ID})
+}
+
+// decodeThreadCursor returns the path a threaded view continues after.
+func decodeThreadCursor(page database.Page) (string, error) {
+	if page.Backward || page.Before != nil {
+		return "", fmt.Errorf("%w: threads can only be paginated forward", database.ErrValidation)
+	}
+	if page.After == nil {
+		return "", nil
+	}
+
+	cur, err := cursor.Decode(*page.After)
+	if err != nil {
+		return "", err
+	}
+	if cur.Order != threadOrder || cur.Path == "" {
+		return "", database.ErrInvalidCursor
+	}
+	return cur.Path, nil
+}
+
+// threadConnection builds a connection from the entries of a threaded view.
+// One entry more than the limit tells that there's a next page.
+func threadConnection(edges []*model.ThreadEdge, page database.Page) *model.ThreadConnection {
+	hasNextPage := page.Limit > 0 && len(edges) > page.Limit
+	if hasNextPage {
+		edges = edges[:page.Limit]
+	}
+	if edges == nil {
+		edges = []*model.ThreadEdge{}
+	}
+
+	var startCursor, endCursor *string
+	if len(edges) > 0 {
+		startCursor = &edges[0].Cursor
+		endCursor = &edges[len(edges)-1].Cursor
+	}
+
+	return &model.ThreadConnection{
+		Edges: edges,
+		PageInfo: &model.PageInfo{
+			StartCursor:     startCursor,
+			EndCursor:       endCursor,
+			HasPreviousPage: page.After != nil,
+			HasNextPage:     hasNextPage,
+		},
+	}
+}
+
+// decodeCursor rejects cursors issued for another order. Cursors without an
+// order predate sorting and are always ascending.
+func decodeCursor(token string, order model.SortOrder) (cursor.Cursor, error) {
+	cur, err := cursor.Decode(token)
+	if err != nil {
+		return cursor.Cursor{}, err
+	}
+	if cur.Order == "" {
+		cur.Order = string(model.SortOrderOldest)
+	}
+	if cur.Order != string(order) {
+		return cursor.Cursor{}, database.ErrInvalidCursor
+	}
+	return cur, nil
+}
+
+// compareKeys compares two positions in the given order.
+func compareKeys(a, b cursor.Cursor, order model.SortOrder) int {
+	c := a.CreatedAt.Compare(b.CreatedAt)
+	if c == 0 {
+		c = cmp.Compare(len(a.ID), len(b.ID))
+	}
+	if c == 0 {
+		c = strings.Compare(a.ID, b.ID)
+	}
+
+	switch order {
+	case model.SortOrderNewest:
+		return -c
+	case model.SortOrderMostReplies:
+		if a.Replies != b.Replies {
+			return cmp.Compare(b.Replies, a.Replies)
+		}
+		return -c
+	default:
+		return c
+	}
+}
+
+// trailingRow scans the columns a list query selects after the model's ones
+// into extra.
+type trailingRow struct {
+	database.Row
+	extra []interface{}
+}
+
+func (r trailingRow) Scan(dest ...interface{}) error {
+	return r.Row.Scan(append(dest, r.extra...)...)
+}
+
+// Postgres error codes that are turned into domain errors.
+const (
+	invalidTextRepresentation = "22P02"
+	foreignKeyViolation       = "23503"
+)
+
+// isNotFound reports whether err means that the row looked up doesn't exist.
+// IDs that aren't valid UUIDs can't match any row either.
+func isNotFound(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == invalidTextRepresentation
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation
+}
+
+func scanPost(row database.Row) (*model.Post, error) {
+	var post model.Post
+	var createdAt time.Time
+	var editedAt, deletedAt *time.Time
+
+	err := row.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.AllowComments,
+		&createdAt, &editedAt, &deletedAt)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	post.CreatedAt = createdAt.Format(time.RFC3339Nano)
+	post.EditedAt = formatTime(editedAt)
+	post.DeletedAt = formatTime(deletedAt)
+
+	return &post, nil
+}
+
+func scanComment(row database.Row) (*model.Comment, error) {
+	var comment model.Comment
+	var createdAt time.Time
+	var editedAt, deletedAt *time.Time
+
+	err := row.Scan(&comment.ID, &comment.AuthorID, &comment.PostID, &comment.ParentID, &comment.Content,
+		&createdAt, &editedAt, &deletedAt, &comment.Locked)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	comment.CreatedAt = createdAt.Format(time.RFC3339Nano)
+	comment.EditedAt = formatTime(editedAt)
+	comment.DeletedAt = formatTime(deletedAt)
+
+	return &comment, nil
+}
+
+// dialect is what the list queries of the SQL backends differ in.
+type dialect struct {
+	// placeholder refers to the n-th query argument.
+	placeholder func(n int) string
+	// timestamp turns the creation time of a cursor into a query argument.
+	timestamp func(t time.Time) interface{}
+}
+
+var postgresDialect = dialect{
+	placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	timestamp:   func(t time.Time) interface{} { return t },
+}
+
+// keyset selects page from rows, a query with created_at, id and reply_count
+// columns. One row more than the limit is fetched to tell whether the page is
+// the last one in its direction.
+func keyset(d dialect, rows string, args []interface{}, page database.Page) (string, []interface{}, error) {
+	order := sortOrder(page)
+
+	columns := "(created_at, id)"
+	descending := order != model.SortOrderOldest
+	if order == model.SortOrderMostReplies {
+		columns = "(reply_count, created_at, id)"
+	}
+
+	var conditions []string
+	for _, bound := range []struct {
+		token *string
+		after bool
+	}{{page.After, true}, {page.Before, false}} {
+		if bound.token == nil {
+			continue
+		}
+		cur, err := decodeCursor(*bound.token, order)
+		if err != nil {
+			return "", nil, err
+		}
+
+		op := ">"
+		if bound.after == descending {
+			op = "<"
+		}
+		if order == model.SortOrderMostReplies {
+			args = append(args, cur.Replies, d.timestamp(cur.CreatedAt), cur.ID)
+			conditions = append(conditions, fmt.Sprintf("%s %s (%s, %s, %s)", columns, op,
+				d.placeholder(len(args)-2), d.placeholder(len(args)-1), d.placeholder(len(args))))
+		} else {
+			args = append(args, d.timestamp(cur.CreatedAt), cur.ID)
+			conditions = append(conditions, fmt.Sprintf("%s %s (%s, %s)", columns, op,
+				d.placeholder(len(args)-1), d.placeholder(len(args))))
+		}
+	}
+
+	query := `SELECT * FROM (` + rows + `) AS t`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query += " ORDER BY " + orderColumns(page)
+
+	if page.Limit > 0 {
+		args = append(args, page.Limit+1)
+		query += " LIMIT " + d.placeholder(len(args))
+	}
+
+	return query, args, nil
+}
+
+// orderColumns lists the columns of a list query in the order the page reads
+// them.
+func orderColumns(page database.Page) string {
+	order := sortOrder(page)
+
+	direction := "ASC"
+	if (order != model.SortOrderOldest) != page.Backward {
+		direction = "DESC"
+	}
+	if order == model.SortOrderMostReplies {
+		return fmt.Sprintf("reply_count %[1]s, created_at %[1]s, id %[1]s", direction)
+	}
+	return fmt.Sprintf("created_at %[1]s, id %[1]s", direction)
+}
+
+// trimPage drops the extra row fetched by keyset and puts backward pages back
+// in ascending order.
+func trimPage[T any](items []T, page database.Page) ([]T, bool, bool) {
+	more := page.Limit > 0 && len(items) > page.Limit
+	if more {
+		items = items[:page.Limit]
+	}
+
+	hasPreviousPage := page.After != nil
+	hasNextPage := page.Before != nil
+	if page.Backward {
+		slices.Reverse(items)
+		hasPreviousPage = hasPreviousPage || more
+	} else {
+		hasNextPage = hasNextPage || more
+	}
+
+	return items, hasPreviousPage, hasNextPage
+}
+
+// commentConnection builds a connection from the rows of a list query; total
+// is the number of rows in the whole connection.
+func commentConnection(edges []*model.CommentEdge, total int32, page database.Page) *model.CommentConnection {
+	edges, hasPreviousPage, hasNextPage := trimPage(edges, page)
+	if edges == nil {
+		edges = []*model.CommentEdge{}
+	}
+
+	var startCursor, endCursor *string
+	if len(edges) > 0 {
+		startCursor = &edges[0].Cursor
+		endCursor = &edges[len(edges)-1].Cursor
+	}
+
+	var totalCount *int32
+	if page.WithTotalCount {
+		totalCount = &total
+	}
+
+	return &model.CommentConnection{
+		Edges: edges,
+		PageInfo: &model.PageInfo{
+			StartCursor:     startCursor,
+			EndCursor:       endCursor,
+			HasPreviousPage: hasPreviousPage,
+			HasNextPage:     hasNextPage,
+		},
+		TotalCount: totalCount,
+	}
+}
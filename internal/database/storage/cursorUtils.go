@@ -1,62 +1,111 @@
 package storage
 
-import "ozon-GraphQL/graph/model"
+import (
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/cursor"
+	"ozon-GraphQL/internal/database"
+	"slices"
+	"sort"
+)
 
-func (r *InMemoryRepository) findIndex(cursor string, posts []*model.Post) int {
-	for i, post := range posts {
-		if post.ID == cursor {
-			return i
+// window returns the items selected by page with their cursors, and whether
+// there are items before and after them. items are in OLDEST order, so the
+// OLDEST and NEWEST windows are found by binary search; only MOST_REPLIES
+// needs sorting.
+func window[T any](items []T, key func(T) cursor.Cursor, page database.Page) ([]T, []string, bool, bool, error) {
+	order := sortOrder(page)
+
+	// at and keyAt return the item at position i in the page's order and
+	// its key.
+	at := func(i int) T { return items[i] }
+	if order == model.SortOrderNewest {
+		at = func(i int) T { return items[len(items)-1-i] }
+	}
+	keyAt := func(i int) cursor.Cursor { return key(at(i)) }
+
+	if order == model.SortOrderMostReplies {
+		keys := make([]cursor.Cursor, len(items))
+		sorted := make([]int, len(items))
+		for i, item := range items {
+			keys[i] = key(item)
+			sorted[i] = i
 		}
+		slices.SortStableFunc(sorted, func(a, b int) int {
+			return compareKeys(keys[a], keys[b], order)
+		})
+		at = func(i int) T { return items[sorted[i]] }
+		keyAt = func(i int) cursor.Cursor { return keys[sorted[i]] }
 	}
-	return -1
-}
 
-func (r *InMemoryRepository) findCommentIndex(cursor string, comments []*model.Comment) int {
-	for i, comment := range comments {
-		if comment.ID == cursor {
-			return i
+	start, end := 0, len(items)
+
+	if page.After != nil {
+		after, err := decodeCursor(*page.After, order)
+		if err != nil {
+			return nil, nil, false, false, err
 		}
+		start = sort.Search(len(items), func(i int) bool {
+			return compareKeys(keyAt(i), after, order) > 0
+		})
 	}
-	return -1
-}
 
-func (r *InMemoryRepository) findReplyIndex(cursor string, edges []*model.CommentEdge) int {
-	for i, edge := range edges {
-		if edge.Cursor == cursor {
-			return i
+	if page.Before != nil {
+		before, err := decodeCursor(*page.Before, order)
+		if err != nil {
+			return nil, nil, false, false, err
 		}
+		end = sort.Search(len(items), func(i int) bool {
+			return compareKeys(keyAt(i), before, order) >= 0
+		})
 	}
-	return -1
-}
 
-func (r *InMemoryRepository) getEndCursor(posts []*model.Post) *string {
-	if len(posts) == 0 {
-		return nil
+	if end < start {
+		end = start
+	}
+
+	hasPreviousPage := page.After != nil
+	hasNextPage := page.Before != nil
+	if page.Limit > 0 && end-start > page.Limit {
+		if page.Backward {
+			start = end - page.Limit
+			hasPreviousPage = true
+		} else {
+			end = start + page.Limit
+			hasNextPage = true
+		}
 	}
-	lastPost := posts[len(posts)-1]
-	return &lastPost.ID
-}
 
-func (r *InMemoryRepository) getEndCursorComments(comments []*model.Comment) *string {
-	if len(comments) == 0 {
-		return nil
+	selected := make([]T, 0, end-start)
+	cursors := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		selected = append(selected, at(i))
+		cursors = append(cursors, cursor.Encode(keyAt(i)))
 	}
-	lastComment := comments[len(comments)-1]
-	return &lastComment.ID
+
+	return selected, cursors, hasPreviousPage, hasNextPage, nil
+}
+
+// insertSorted adds item to items, which are kept in OLDEST order. Items are
+// mostly created in that order, so this is usually an append.
+func insertSorted[T any](items []T, item T, key func(T) cursor.Cursor) []T {
+	k := key(item)
+	i := sort.Search(len(items), func(i int) bool {
+		return compareKeys(key(items[i]), k, model.SortOrderOldest) > 0
+	})
+	return slices.Insert(items, i, item)
 }
 
-func (r *InMemoryRepository) getEndCursorEdges(edges []*model.CommentEdge) *string {
-	if len(edges) == 0 {
-		return nil
+// replace puts new in place of old in items.
+func replace[T comparable](items []T, old, new T) {
+	if i := slices.Index(items, old); i >= 0 {
+		items[i] = new
 	}
-	lastEdge := edges[len(edges)-1]
-	return &lastEdge.Cursor
 }
 
-func (r *InMemoryRepository) postsToSlice() []*model.Post {
-	var posts []*model.Post
-	for _, post := range r.posts {
-		posts = append(posts, post)
+// without returns items minus the given one, keeping the order.
+func without[T comparable](items []T, item T) []T {
+	if i := slices.Index(items, item); i >= 0 {
+		return append(items[:i:i], items[i+1:]...)
 	}
-	return posts
+	return items
 }
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lockDir creates the lock file in dir exclusively. Without flock a crash
+// leaves it behind, and it has to be removed by hand before the next start.
+func lockDir(dir string) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("%s is in use by another process, or %s was left by a crash", dir, lockFile)
+	}
+	return f, err
+}
+
+func unlockDir(f *os.File) error {
+	return errors.Join(f.Close(), os.Remove(f.Name()))
+}
@@ -0,0 +1,586 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/database"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+const (
+	walFile      = "wal.log"
+	snapshotFile = "snapshot.db"
+	lockFile     = "LOCK"
+)
+
+// WAL operations. Records carry the state of the row after the mutation, so
+// replaying a record twice is harmless: a crash between writing a snapshot and
+// emptying the log replays records the snapshot already has.
+const (
+	opPutPost       = "put_post"
+	opPutComment    = "put_comment"
+	opRemoveComment = "remove_comment"
+)
+
+// snapshotVersion is the format of the snapshot and of the log, which is
+// emptied whenever a snapshot is written. Bump it when postRecord or
+// commentRecord change in a way older records can't be read with.
+const snapshotVersion = 1
+
+type walRecord struct {
+	Op      string         `json:"op"`
+	Post    *postRecord    `json:"post,omitempty"`
+	Comment *commentRecord `json:"comment,omitempty"`
+}
+
+// snapshotHeader is the first record of a snapshot, followed by a record
+// holding the fileSnapshot.
+type snapshotHeader struct {
+	Version int `json:"version"`
+}
+
+type fileSnapshot struct {
+	LastID uint64       `json:"lastId"`
+	Posts  []postRecord `json:"posts"`
+	// Comments are in OLDEST order within each post.
+	Comments []commentRecord `json:"comments"`
+}
+
+// postRecord and commentRecord are how rows are stored, kept apart from the
+// GraphQL models so that a schema change doesn't change the files.
+type postRecord struct {
+	ID            string  `json:"id"`
+	AuthorID      string  `json:"authorId"`
+	Title         string  `json:"title"`
+	Content       string  `json:"content"`
+	AllowComments bool    `json:"allowComments"`
+	CreatedAt     string  `json:"createdAt"`
+	EditedAt      *string `json:"editedAt,omitempty"`
+	DeletedAt     *string `json:"deletedAt,omitempty"`
+}
+
+type commentRecord struct {
+	ID        string  `json:"id"`
+	AuthorID  string  `json:"authorId"`
+	PostID    string  `json:"postId"`
+	ParentID  *string `json:"parentId,omitempty"`
+	Content   string  `json:"content"`
+	CreatedAt string  `json:"createdAt"`
+	EditedAt  *string `json:"editedAt,omitempty"`
+	DeletedAt *string `json:"deletedAt,omitempty"`
+	Locked    bool    `json:"locked"`
+}
+
+func newPostRecord(post *model.Post) *postRecord {
+	return &postRecord{
+		ID:            post.ID,
+		AuthorID:      post.AuthorID,
+		Title:         post.Title,
+		Content:       post.Content,
+		AllowComments: post.AllowComments,
+		CreatedAt:     post.CreatedAt,
+		EditedAt:      post.EditedAt,
+		DeletedAt:     post.DeletedAt,
+	}
+}
+
+func (p *postRecord) model() *model.Post {
+	return &model.Post{
+		ID:            p.ID,
+		AuthorID:      p.AuthorID,
+		Title:         p.Title,
+		Content:       p.Content,
+		AllowComments: p.AllowComments,
+		CreatedAt:     p.CreatedAt,
+		EditedAt:      p.EditedAt,
+		DeletedAt:     p.DeletedAt,
+	}
+}
+
+func newCommentRecord(comment *model.Comment) *commentRecord {
+	return &commentRecord{
+		ID:        comment.ID,
+		AuthorID:  comment.AuthorID,
+		PostID:    comment.PostID,
+		ParentID:  comment.ParentID,
+		Content:   comment.Content,
+		CreatedAt: comment.CreatedAt,
+		EditedAt:  comment.EditedAt,
+		DeletedAt: comment.DeletedAt,
+		Locked:    comment.Locked,
+	}
+}
+
+func (c *commentRecord) model() *model.Comment {
+	return &model.Comment{
+		ID:        c.ID,
+		AuthorID:  c.AuthorID,
+		PostID:    c.PostID,
+		ParentID:  c.ParentID,
+		Content:   c.Content,
+		CreatedAt: c.CreatedAt,
+		EditedAt:  c.EditedAt,
+		DeletedAt: c.DeletedAt,
+		Locked:    c.Locked,
+	}
+}
+
+// FileRepository is an InMemoryRepository that survives restarts. Every
+// mutation is appended to a write-ahead log and fsynced before it's
+// acknowledged; every snapshotEvery records the whole state is written to a
+// snapshot and the log starts over. Opening the repository loads the snapshot
+// and replays the log, dropping a torn record at its end. The directory is
+// locked while the repository is open, so two processes can't interleave
+// their records.
+type FileRepository struct {
+	mem           *InMemoryRepository
+	dir           string
+	snapshotEvery int
+	lock          *os.File
+
+	// mutex serializes mutations together with their records, so the log
+	// has them in the order they were applied.
+	mutex   sync.Mutex
+	wal     *os.File
+	records int
+	// err is set when a record couldn't be written. The log may end with a
+	// partial record then, so nothing is appended after it. The failed
+	// mutation is never applied to memory.
+	err error
+}
+
+var _ database.Repository = (*FileRepository)(nil)
+
+// NewFileRepository opens the repository kept in dir, creating it if needed.
+// snapshotEvery <= 0 only writes a snapshot on Close.
+func NewFileRepository(dir string, snapshotEvery int) (*FileRepository, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	lock, err := lockDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &FileRepository{
+		mem:           NewInMemoryRepository(),
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+		lock:          lock,
+	}
+	if err := r.open(); err != nil {
+		unlockDir(lock)
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *FileRepository) open() error {
+	if err := r.loadSnapshot(); err != nil {
+		return err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(r.dir, walFile), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	r.wal = wal
+	if err := r.replay(); err != nil {
+		wal.Close()
+		return err
+	}
+	if err := syncDir(r.dir); err != nil {
+		wal.Close()
+		return err
+	}
+	return nil
+}
+
+func (r *FileRepository) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(r.dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Snapshots are replaced atomically, so a broken one isn't a crash
+	// artifact and there's nothing sensible to fall back to.
+	reader := bufio.NewReader(f)
+	payload, err := readRecord(reader)
+	if err != nil {
+		return fmt.Errorf("read snapshot header: %w", err)
+	}
+	var header snapshotHeader
+	if err := json.Unmarshal(payload, &header); err != nil {
+		return fmt.Errorf("decode snapshot header: %w", err)
+	}
+	if header.Version != snapshotVersion {
+		return fmt.Errorf("snapshot format version %d isn't supported", header.Version)
+	}
+
+	payload, err = readRecord(reader)
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+	var snapshot fileSnapshot
+	if err := json.Unmarshal(payload, &snapshot); err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+
+	r.mem.lastID.Store(snapshot.LastID)
+	for _, post := range snapshot.Posts {
+		r.mem.restorePost(post.model())
+	}
+	for _, comment := range snapshot.Comments {
+		r.mem.restoreComment(comment.model())
+	}
+	return nil
+}
+
+// replay applies the log and cuts it after the last intact record. A crash
+// can only damage the record being appended, so a broken record is dropped
+// only if it ends the log; anything after it means the log itself is
+// damaged, and replaying around the hole would lose acknowledged writes.
+func (r *FileRepository) replay() error {
+	reader := bufio.NewReader(r.wal)
+	var offset int64
+	for {
+		payload, err := readRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, errCorruptRecord) {
+			if _, err := reader.Peek(1); err != io.EOF {
+				if err != nil {
+					return err
+				}
+				return fmt.Errorf("%w at offset %d of %s is followed by more records", errCorruptRecord, offset, walFile)
+			}
+		}
+		if errors.Is(err, errTornRecord) || errors.Is(err, errCorruptRecord) {
+			log.Printf("file storage: dropping a torn record at offset %d of %s", offset, walFile)
+			if err := r.wal.Truncate(offset); err != nil {
+				return err
+			}
+			return r.wal.Sync()
+		}
+		if err != nil {
+			return err
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return fmt.Errorf("decode wal record at offset %d: %w", offset, err)
+		}
+		if err := r.mem.apply(record); err != nil {
+			return fmt.Errorf("apply wal record at offset %d: %w", offset, err)
+		}
+		offset += int64(recordHeaderSize + len(payload))
+		r.records++
+	}
+}
+
+// commit appends record to the log, waits until it's on disk and only then
+// applies it to memory, so that nothing is served that a restart would lose.
+func (r *FileRepository) commit(record walRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := r.wal.Write(encodeRecord(payload)); err != nil {
+		r.err = fmt.Errorf("file storage is read-only after a failed write: %w", err)
+		return r.err
+	}
+	if err := r.wal.Sync(); err != nil {
+		r.err = fmt.Errorf("file storage is read-only after a failed sync: %w", err)
+		return r.err
+	}
+
+	r.mem.mutex.Lock()
+	err = r.mem.apply(record)
+	r.mem.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	r.records++
+	if r.snapshotEvery > 0 && r.records >= r.snapshotEvery {
+		// The record is durable already, a failed snapshot only means a
+		// longer replay.
+		if err := r.compact(); err != nil {
+			log.Printf("file storage: snapshot failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// compact writes the whole state to a snapshot and empties the log.
+func (r *FileRepository) compact() error {
+	header, err := json.Marshal(snapshotHeader{Version: snapshotVersion})
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(r.mem.snapshot())
+	if err != nil {
+		return err
+	}
+	data := append(encodeRecord(header), encodeRecord(payload)...)
+	if err := writeFileSync(filepath.Join(r.dir, snapshotFile), data); err != nil {
+		return err
+	}
+	if err := syncDir(r.dir); err != nil {
+		return err
+	}
+	if err := r.wal.Truncate(0); err != nil {
+		return err
+	}
+	if err := r.wal.Sync(); err != nil {
+		return err
+	}
+	r.records = 0
+	return nil
+}
+
+// Close writes a snapshot so the next start has no log to replay.
+func (r *FileRepository) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var err error
+	if r.err == nil && r.records > 0 {
+		err = r.compact()
+	}
+	return errors.Join(err, r.wal.Close(), unlockDir(r.lock))
+}
+
+// The mutations below build their rows with the InMemoryRepository without
+// storing them and hand them to commit. They read its maps without the lock:
+// only commit changes them, and r.mutex keeps other mutations out.
+
+func (r *FileRepository) logPost(post *model.Post, err error) (*model.Post, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := r.commit(walRecord{Op: opPutPost, Post: newPostRecord(post)}); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+func (r *FileRepository) logComment(comment *model.Comment, err error) (*model.Comment, error) {
+	if err != nil {
+		return nil, err
+	}
+	if err := r.commit(walRecord{Op: opPutComment, Comment: newCommentRecord(comment)}); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (r *FileRepository) CreatePost(ctx context.Context, authorID, title, content string, allowComments bool) (*model.Post, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.logPost(r.mem.newPost(authorID, title, content, allowComments), nil)
+}
+
+func (r *FileRepository) GetPosts(ctx context.Context, page database.Page) (*model.PostConnection, error) {
+	return r.mem.GetPosts(ctx, page)
+}
+
+func (r *FileRepository) GetPostByID(ctx context.Context, id string) (*model.Post, error) {
+	return r.mem.GetPostByID(ctx, id)
+}
+
+func (r *FileRepository) UpdatePost(ctx context.Context, id string, title, content *string) (*model.Post, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.logPost(r.mem.updatedPost(id, title, content))
+}
+
+func (r *FileRepository) DeletePost(ctx context.Context, id string) (*model.Post, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.logPost(r.mem.deletedPost(id))
+}
+
+func (r *FileRepository) SetPostCommentsEnabled(ctx context.Context, id string, enabled bool) (*model.Post, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.logPost(r.mem.postWithCommentsEnabled(id, enabled))
+}
+
+func (r *FileRepository) CreateComment(ctx context.Context, authorID, postID string, content string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.logComment(r.mem.newComment(authorID, postID, content))
+}
+
+func (r *FileRepository) GetCommentByID(ctx context.Context, id string) (*model.Comment, error) {
+	return r.mem.GetCommentByID(ctx, id)
+}
+
+func (r *FileRepository) GetComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
+	return r.mem.GetComments(ctx, postID, page)
+}
+
+func (r *FileRepository) GetPostComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
+	return r.mem.GetPostComments(ctx, postID, page)
+}
+
+func (r *FileRepository) CreateReply(ctx context.Context, authorID, postID string, content string, parentID *string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.logComment(r.mem.newReply(authorID, postID, content, parentID))
+}
+
+func (r *FileRepository) GetRepliesByCommentID(ctx context.Context, commentID string, page database.Page) (*model.CommentConnection, error) {
+	return r.mem.GetRepliesByCommentID(ctx, commentID, page)
+}
+
+func (r *FileRepository) GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, page database.Page) (map[string]*model.CommentConnection, error) {
+	return r.mem.GetRepliesByCommentIDs(ctx, commentIDs, page)
+}
+
+func (r *FileRepository) GetCommentSubtree(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	return r.mem.GetCommentSubtree(ctx, commentID)
+}
+
+func (r *FileRepository) GetCommentAncestors(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	return r.mem.GetCommentAncestors(ctx, commentID)
+}
+
+func (r *FileRepository) GetCommentThread(ctx context.Context, postID string, maxDepth *int, page database.Page) (*model.ThreadConnection, error) {
+	return r.mem.GetCommentThread(ctx, postID, maxDepth, page)
+}
+
+func (r *FileRepository) UpdateComment(ctx context.Context, id, content string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.logComment(r.mem.updatedComment(id, content))
+}
+
+func (r *FileRepository) DeleteComment(ctx context.Context, id string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	comment, tombstone, err := r.mem.deletedComment(id)
+	if err != nil {
+		return nil, err
+	}
+
+	op := opRemoveComment
+	if tombstone {
+		op = opPutComment
+	}
+	if err := r.commit(walRecord{Op: op, Comment: newCommentRecord(comment)}); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (r *FileRepository) LockThread(ctx context.Context, id string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return r.logComment(r.mem.lockedComment(id))
+}
+
+// The methods below rebuild an InMemoryRepository from a snapshot and the
+// log. They run before the repository is shared, so they don't lock it;
+// commit locks it around apply.
+
+func (r *InMemoryRepository) apply(record walRecord) error {
+	switch {
+	case record.Op == opPutPost && record.Post != nil:
+		r.restorePost(record.Post.model())
+	case record.Op == opPutComment && record.Comment != nil:
+		r.restoreComment(record.Comment.model())
+	case record.Op == opRemoveComment && record.Comment != nil:
+		if comment, ok := r.comments[record.Comment.ID]; ok {
+			r.removeComment(comment)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q", record.Op)
+	}
+	return nil
+}
+
+func (r *InMemoryRepository) restorePost(post *model.Post) {
+	r.observeID(post.ID)
+	r.putPost(post)
+}
+
+func (r *InMemoryRepository) restoreComment(comment *model.Comment) {
+	r.observeID(comment.ID)
+	r.putComment(comment)
+}
+
+// observeID keeps nextID ahead of the restored IDs.
+func (r *InMemoryRepository) observeID(id string) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err == nil && n > r.lastID.Load() {
+		r.lastID.Store(n)
+	}
+}
+
+func (r *InMemoryRepository) snapshot() fileSnapshot {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	snapshot := fileSnapshot{LastID: r.lastID.Load()}
+	for _, post := range r.postOrder {
+		snapshot.Posts = append(snapshot.Posts, *newPostRecord(post))
+		for _, comment := range r.postComments[post.ID] {
+			snapshot.Comments = append(snapshot.Comments, *newCommentRecord(comment))
+		}
+	}
+	return snapshot
+}
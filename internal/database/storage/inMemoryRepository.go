@@ -1,263 +1,648 @@
 package storage
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/cursor"
+	"ozon-GraphQL/internal/database"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// InMemoryRepository keeps posts and comments in maps indexed the way they are
+// looked up. Slices hold items in OLDEST order, so that pages are cut out of
+// them without sorting. Posts and comments are read
+// without the lock once they are handed out, so they're never changed in
+// place: a mutation stores an updated copy instead.
 type InMemoryRepository struct {
-	posts    map[string]*model.Post
-	comments map[string][]*model.Comment
-	mutex    sync.RWMutex
+	posts        map[string]*model.Post
+	postOrder    []*model.Post
+	livePosts    []*model.Post
+	comments     map[string]*model.Comment
+	postComments map[string][]*model.Comment
+	rootComments map[string][]*model.Comment
+	replies      map[string][]*model.Comment
+	lastID       atomic.Uint64
+	mutex        sync.RWMutex
 }
 
 func NewInMemoryRepository() *InMemoryRepository {
 	return &InMemoryRepository{
-		posts:    make(map[string]*model.Post),
-		comments: make(map[string][]*model.Comment),
+		posts:        make(map[string]*model.Post),
+		comments:     make(map[string]*model.Comment),
+		postComments: make(map[string][]*model.Comment),
+		rootComments: make(map[string][]*model.Comment),
+		replies:      make(map[string][]*model.Comment),
 	}
 }
 
-func (r *InMemoryRepository) CreatePost(authorID, title, content string, allowComments bool) (*model.Post, error) {
+// nextID hands out IDs that are unique across posts and comments and are
+// never reused, even after deletes.
+func (r *InMemoryRepository) nextID() string {
+	return strconv.FormatUint(r.lastID.Add(1), 10)
+}
+
+func oldestPostKey(post *model.Post) cursor.Cursor {
+	return postKey(post, 0, model.SortOrderOldest)
+}
+
+func oldestCommentKey(comment *model.Comment) cursor.Cursor {
+	return commentKey(comment, 0, model.SortOrderOldest)
+}
+
+// addPost keeps deleted posts in postOrder, which is what snapshots store,
+// and only live ones in livePosts, which is what GetPosts pages through.
+func (r *InMemoryRepository) addPost(post *model.Post) {
+	r.posts[post.ID] = post
+	r.postOrder = insertSorted(r.postOrder, post, oldestPostKey)
+	if post.DeletedAt == nil {
+		r.livePosts = insertSorted(r.livePosts, post, oldestPostKey)
+	}
+}
+
+func (r *InMemoryRepository) addComment(comment *model.Comment) {
+	r.comments[comment.ID] = comment
+	r.postComments[comment.PostID] = insertSorted(r.postComments[comment.PostID], comment, oldestCommentKey)
+	if comment.ParentID != nil {
+		r.replies[*comment.ParentID] = insertSorted(r.replies[*comment.ParentID], comment, oldestCommentKey)
+	} else {
+		r.rootComments[comment.PostID] = insertSorted(r.rootComments[comment.PostID], comment, oldestCommentKey)
+	}
+}
+
+func (r *InMemoryRepository) replacePost(post *model.Post) {
+	old := r.posts[post.ID]
+	r.posts[post.ID] = post
+	replace(r.postOrder, old, post)
+	if post.DeletedAt != nil {
+		r.livePosts = without(r.livePosts, old)
+	} else {
+		replace(r.livePosts, old, post)
+	}
+}
+
+func (r *InMemoryRepository) replaceComment(comment *model.Comment) {
+	old := r.comments[comment.ID]
+	r.comments[comment.ID] = comment
+	replace(r.postComments[comment.PostID], old, comment)
+	if comment.ParentID != nil {
+		replace(r.replies[*comment.ParentID], old, comment)
+	} else {
+		replace(r.rootComments[comment.PostID], old, comment)
+	}
+}
+
+// liveComment looks up a comment that is still visible: the comments of a
+// deleted post are gone with it.
+func (r *InMemoryRepository) liveComment(id string) (*model.Comment, bool) {
+	comment, ok := r.comments[id]
+	if !ok {
+		return nil, false
+	}
+	post, ok := r.posts[comment.PostID]
+	return comment, ok && post.DeletedAt == nil
+}
+
+// Mutations are split in two: newPost, updatedComment and the like build the
+// rows a mutation stores without changing anything, and putPost, putComment
+// and removeComment store them. FileRepository logs the rows in between.
+
+// putPost adds the post or overwrites the one with its ID.
+func (r *InMemoryRepository) putPost(post *model.Post) {
+	if _, ok := r.posts[post.ID]; ok {
+		r.replacePost(post)
+		return
+	}
+	r.addPost(post)
+}
+
+// putComment adds the comment or overwrites the one with its ID.
+func (r *InMemoryRepository) putComment(comment *model.Comment) {
+	if _, ok := r.comments[comment.ID]; ok {
+		r.replaceComment(comment)
+		return
+	}
+	r.addComment(comment)
+}
+
+func (r *InMemoryRepository) putPostOf(post *model.Post, err error) (*model.Post, error) {
+	if err != nil {
+		return nil, err
+	}
+	r.putPost(post)
+	return post, nil
+}
+
+func (r *InMemoryRepository) putCommentOf(comment *model.Comment, err error) (*model.Comment, error) {
+	if err != nil {
+		return nil, err
+	}
+	r.putComment(comment)
+	return comment, nil
+}
+
+func (r *InMemoryRepository) removeComment(comment *model.Comment) {
+	delete(r.comments, comment.ID)
+	r.postComments[comment.PostID] = without(r.postComments[comment.PostID], comment)
+	if comment.ParentID != nil {
+		r.replies[*comment.ParentID] = without(r.replies[*comment.ParentID], comment)
+	} else {
+		r.rootComments[comment.PostID] = without(r.rootComments[comment.PostID], comment)
+	}
+}
+
+func (r *InMemoryRepository) CreatePost(ctx context.Context, authorID, title, content string, allowComments bool) (*model.Post, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	post := &model.Post{
-		ID:            strconv.Itoa(len(r.posts) + 1),
+	post := r.newPost(authorID, title, content, allowComments)
+	r.putPost(post)
+
+	return post, nil
+}
+
+func (r *InMemoryRepository) newPost(authorID, title, content string, allowComments bool) *model.Post {
+	return &model.Post{
+		ID:            r.nextID(),
 		AuthorID:      authorID,
 		Title:         title,
 		Content:       content,
 		AllowComments: allowComments,
+		CreatedAt:     time.Now().Format(time.RFC3339Nano),
 	}
-
-	r.posts[post.ID] = post
-
-	return post, nil
 }
 
-func (r *InMemoryRepository) GetPosts(limit int, after *string) (*model.PostConnection, error) {
+func (r *InMemoryRepository) GetPosts(ctx context.Context, page database.Page) (*model.PostConnection, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	posts := r.postsToSlice()
-
-	startIndex := 0
-	if after != nil {
-		startIndex = r.findIndex(*after, posts)
-		if startIndex == -1 {
-			return nil, errors.New("invalid cursor")
-		}
-		startIndex++
-	}
+	posts := r.livePosts
 
-	endIndex := len(posts)
-	if limit > 0 && limit < len(posts)-startIndex {
-		endIndex = startIndex + limit
+	order := sortOrder(page)
+	selected, cursors, hasPreviousPage, hasNextPage, err := window(posts, func(post *model.Post) cursor.Cursor {
+		return postKey(post, len(r.postComments[post.ID]), order)
+	}, page)
+	if err != nil {
+		return nil, err
 	}
 
-	var edges []*model.PostEdge
-	for _, post := range posts[startIndex:endIndex] {
+	edges := []*model.PostEdge{}
+	for i, post := range selected {
 		edges = append(edges, &model.PostEdge{
-			Cursor: post.ID,
+			Cursor: cursors[i],
 			Node:   post,
 		})
 	}
 
-	hasNextPage := endIndex < len(posts)
+	var startCursor, endCursor *string
+	if len(edges) > 0 {
+		startCursor = &edges[0].Cursor
+		endCursor = &edges[len(edges)-1].Cursor
+	}
+
+	var totalCount *int32
+	if page.WithTotalCount {
+		count := int32(len(posts))
+		totalCount = &count
+	}
 
 	return &model.PostConnection{
 		Edges: edges,
 		PageInfo: &model.PageInfo{
-			EndCursor:   r.getEndCursor(posts[startIndex:endIndex]),
-			HasNextPage: hasNextPage,
+			StartCursor:     startCursor,
+			EndCursor:       endCursor,
+			HasPreviousPage: hasPreviousPage,
+			HasNextPage:     hasNextPage,
 		},
+		TotalCount: totalCount,
 	}, nil
 }
 
-func (r *InMemoryRepository) GetPostByID(id string) (*model.Post, error) {
+func (r *InMemoryRepository) GetPostByID(ctx context.Context, id string) (*model.Post, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
 	post, ok := r.posts[id]
-	if !ok {
-		return nil, errors.New("post not found")
+	if !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
 	}
 
 	return post, nil
 }
 
-func (r *InMemoryRepository) CreateComment(authorID, postID string, content string) (*model.Comment, error) {
+func (r *InMemoryRepository) UpdatePost(ctx context.Context, id string, title, content *string) (*model.Post, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	_, ok := r.posts[postID]
-	if !ok {
-		return nil, errors.New("post not found")
+	return r.putPostOf(r.updatedPost(id, title, content))
+}
+
+func (r *InMemoryRepository) updatedPost(id string, title, content *string) (*model.Post, error) {
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+
+	updated := *post
+	if title != nil {
+		updated.Title = *title
+	}
+	if content != nil {
+		updated.Content = *content
+	}
+	editedAt := time.Now().Format(time.RFC3339Nano)
+	updated.EditedAt = &editedAt
+
+	return &updated, nil
+}
+
+func (r *InMemoryRepository) DeletePost(ctx context.Context, id string) (*model.Post, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.putPostOf(r.deletedPost(id))
+}
+
+func (r *InMemoryRepository) deletedPost(id string) (*model.Post, error) {
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+
+	deleted := *post
+	deletedAt := time.Now().Format(time.RFC3339Nano)
+	deleted.DeletedAt = &deletedAt
+
+	return &deleted, nil
+}
+
+func (r *InMemoryRepository) SetPostCommentsEnabled(ctx context.Context, id string, enabled bool) (*model.Post, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.putPostOf(r.postWithCommentsEnabled(id, enabled))
+}
+
+func (r *InMemoryRepository) postWithCommentsEnabled(id string, enabled bool) (*model.Post, error) {
+	post, ok := r.posts[id]
+	if !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+
+	updated := *post
+	updated.AllowComments = enabled
+
+	return &updated, nil
+}
+
+func (r *InMemoryRepository) CreateComment(ctx context.Context, authorID, postID string, content string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.putCommentOf(r.newComment(authorID, postID, content))
+}
+
+func (r *InMemoryRepository) newComment(authorID, postID string, content string) (*model.Comment, error) {
+	if post, ok := r.posts[postID]; !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
 	}
 
 	comment := &model.Comment{
-		ID:        strconv.Itoa(len(r.comments[postID]) + 1),
+		ID:        r.nextID(),
 		AuthorID:  authorID,
 		PostID:    postID,
 		Content:   content,
-		CreatedAt: time.Now().Format(time.RFC3339),
-		Replies:   &model.CommentConnection{Edges: []*model.CommentEdge{}},
+		CreatedAt: time.Now().Format(time.RFC3339Nano),
 	}
 
-	r.comments[postID] = append(r.comments[postID], comment)
+	return comment, nil
+}
+
+func (r *InMemoryRepository) GetCommentByID(ctx context.Context, id string) (*model.Comment, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	comment, ok := r.liveComment(id)
+	if !ok {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
+	}
 
 	return comment, nil
 }
 
-func (r *InMemoryRepository) GetComments(postID string, limit int, after *string) (*model.CommentConnection, error) {
+func (r *InMemoryRepository) GetComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if post, ok := r.posts[postID]; !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+
+	return r.commentsConnection(r.rootComments[postID], page)
+}
+
+func (r *InMemoryRepository) GetPostComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	comments, ok := r.comments[postID]
+	if post, ok := r.posts[postID]; !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+
+	return r.commentsConnection(r.postComments[postID], page)
+}
+
+func (r *InMemoryRepository) CreateReply(ctx context.Context, authorID, postID string, content string, parentID *string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.putCommentOf(r.newReply(authorID, postID, content, parentID))
+}
+
+func (r *InMemoryRepository) newReply(authorID, postID string, content string, parentID *string) (*model.Comment, error) {
+	if post, ok := r.posts[postID]; !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+
+	parent, ok := r.liveComment(*parentID)
 	if !ok {
-		return nil, errors.New("comments not found")
+		return nil, fmt.Errorf("parent comment %w", database.ErrNotFound)
+	}
+	if parent.PostID != postID {
+		return nil, fmt.Errorf("%w: parent comment belongs to another post", database.ErrValidation)
+	}
+
+	reply := &model.Comment{
+		ID:        r.nextID(),
+		AuthorID:  authorID,
+		PostID:    postID,
+		ParentID:  &parent.ID,
+		Content:   content,
+		CreatedAt: time.Now().Format(time.RFC3339Nano),
+	}
+
+	return reply, nil
+}
+
+func (r *InMemoryRepository) GetRepliesByCommentID(ctx context.Context, commentID string, page database.Page) (*model.CommentConnection, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if _, ok := r.liveComment(commentID); !ok {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
 	}
 
-	startIndex := 0
-	if after != nil {
-		startIndex = r.findCommentIndex(*after, comments)
-		if startIndex == -1 {
-			return nil, errors.New("invalid cursor")
+	return r.commentsConnection(r.replies[commentID], page)
+}
+
+func (r *InMemoryRepository) GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, page database.Page) (map[string]*model.CommentConnection, error) {
+	if page.After != nil || page.Before != nil {
+		return nil, fmt.Errorf("%w: cursors can't be used to load replies of several comments", database.ErrValidation)
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	conns := make(map[string]*model.CommentConnection, len(commentIDs))
+	for _, id := range commentIDs {
+		var replies []*model.Comment
+		if _, ok := r.liveComment(id); ok {
+			replies = r.replies[id]
+		}
+		conn, err := r.commentsConnection(replies, page)
+		if err != nil {
+			return nil, err
 		}
-		startIndex++
+		conns[id] = conn
 	}
 
-	endIndex := len(comments)
-	if limit > 0 && limit < len(comments)-startIndex {
-		endIndex = startIndex + limit
+	return conns, nil
+}
+
+func (r *InMemoryRepository) commentsConnection(comments []*model.Comment, page database.Page) (*model.CommentConnection, error) {
+	order := sortOrder(page)
+	selected, cursors, hasPreviousPage, hasNextPage, err := window(comments, func(comment *model.Comment) cursor.Cursor {
+		return commentKey(comment, len(r.replies[comment.ID]), order)
+	}, page)
+	if err != nil {
+		return nil, err
 	}
 
-	var edges []*model.CommentEdge
-	for _, comment := range comments[startIndex:endIndex] {
+	edges := []*model.CommentEdge{}
+	for i, comment := range selected {
 		edges = append(edges, &model.CommentEdge{
-			Cursor: comment.ID,
+			Cursor: cursors[i],
 			Node:   comment,
 		})
 	}
 
-	hasNextPage := endIndex < len(comments)
+	var startCursor, endCursor *string
+	if len(edges) > 0 {
+		startCursor = &edges[0].Cursor
+		endCursor = &edges[len(edges)-1].Cursor
+	}
+
+	var totalCount *int32
+	if page.WithTotalCount {
+		count := int32(len(comments))
+		totalCount = &count
+	}
 
 	return &model.CommentConnection{
 		Edges: edges,
 		PageInfo: &model.PageInfo{
-			EndCursor:   r.getEndCursorComments(comments[startIndex:endIndex]),
-			HasNextPage: hasNextPage,
+			StartCursor:     startCursor,
+			EndCursor:       endCursor,
+			HasPreviousPage: hasPreviousPage,
+			HasNextPage:     hasNextPage,
 		},
+		TotalCount: totalCount,
 	}, nil
 }
 
-func (r *InMemoryRepository) CreateReply(authorID, postID string, content string, parentID *string) (*model.Comment, error) {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+func (r *InMemoryRepository) GetCommentSubtree(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 
-	comments, ok := r.comments[postID]
+	comment, ok := r.liveComment(commentID)
 	if !ok {
-		return nil, errors.New("post not found")
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
 	}
 
-	var parent *model.Comment
-	for _, c := range comments {
-		if c.ID == *parentID {
-			parent = c
-			break
+	var subtree []*model.Comment
+	var walk func(comment *model.Comment)
+	walk = func(comment *model.Comment) {
+		subtree = append(subtree, comment)
+		for _, reply := range r.replies[comment.ID] {
+			walk(reply)
 		}
 	}
+	walk(comment)
 
-	if parent == nil {
-		return nil, errors.New("parent comment not found")
-	}
+	return subtree, nil
+}
 
-	reply := &model.Comment{
-		ID:        strconv.Itoa(len(comments) + 1),
-		AuthorID:  authorID,
-		PostID:    postID,
-		ParentID:  parentID,
-		Content:   content,
-		CreatedAt: time.Now().Format(time.RFC3339),
-	}
+func (r *InMemoryRepository) GetCommentAncestors(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 
-	if parent.Replies == nil {
-		parent.Replies = &model.CommentConnection{Edges: []*model.CommentEdge{}}
+	comment, ok := r.liveComment(commentID)
+	if !ok {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
 	}
 
-	parent.Replies.Edges = append(parent.Replies.Edges, &model.CommentEdge{
-		Cursor: reply.ID,
-		Node:   reply,
-	})
-
-	r.comments[postID] = append(comments, reply)
+	ancestors := []*model.Comment{comment}
+	for comment.ParentID != nil {
+		if comment, ok = r.comments[*comment.ParentID]; !ok {
+			break
+		}
+		ancestors = append(ancestors, comment)
+	}
 
-	return reply, nil
+	return ancestors, nil
 }
 
-func (r *InMemoryRepository) GetRepliesByCommentID(commentID string, limit int, after *string) (*model.CommentConnection, error) {
+func (r *InMemoryRepository) GetCommentThread(ctx context.Context, postID string, maxDepth *int, page database.Page) (*model.ThreadConnection, error) {
+	after, err := decodeThreadCursor(page)
+	if err != nil {
+		return nil, err
+	}
+
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	var parentComment *model.Comment
-	for _, comments := range r.comments {
-		for _, comment := range comments {
-			if comment.ID == commentID {
-				parentComment = comment
-				break
+	if post, ok := r.posts[postID]; !ok || post.DeletedAt != nil {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+
+	var edges []*model.ThreadEdge
+	var walk func(comment *model.Comment, depth int, path string) bool
+	walk = func(comment *model.Comment, depth int, path string) bool {
+		if page.Limit > 0 && len(edges) > page.Limit {
+			return false
+		}
+
+		path += memoryPathSegment(comment)
+		cutOff := maxDepth != nil && depth == *maxDepth
+		if path > after {
+			edges = append(edges, &model.ThreadEdge{
+				Cursor: threadCursor(comment, path),
+				Node: &model.ThreadComment{
+					Comment:        comment,
+					Depth:          int32(depth),
+					ContinueThread: cutOff && len(r.replies[comment.ID]) > 0,
+				},
+			})
+		}
+
+		if cutOff {
+			return true
+		}
+		for _, reply := range r.replies[comment.ID] {
+			if !walk(reply, depth+1, path+"/") {
+				return false
 			}
 		}
-		if parentComment != nil {
+		return true
+	}
+
+	for _, comment := range r.rootComments[postID] {
+		if !walk(comment, 0, "") {
 			break
 		}
 	}
 
-	if parentComment == nil {
-		return nil, errors.New("comment not found")
+	return threadConnection(edges, page), nil
+}
+
+// memoryPathSegment is pathSegment with the ID zero-padded to the width of a
+// uint64, so that the IDs handed out by nextID compare as numbers and "10"
+// doesn't sort before its older sibling "9".
+func memoryPathSegment(comment *model.Comment) string {
+	id := comment.ID
+	if pad := 20 - len(id); pad > 0 {
+		id = strings.Repeat("0", pad) + id
 	}
+	return pathSegment(comment.CreatedAt, id)
+}
 
-	replies := parentComment.Replies
-	if replies == nil {
-		return &model.CommentConnection{
-			Edges:    []*model.CommentEdge{},
-			PageInfo: &model.PageInfo{HasNextPage: false},
-		}, nil
+func (r *InMemoryRepository) UpdateComment(ctx context.Context, id, content string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.putCommentOf(r.updatedComment(id, content))
+}
+
+func (r *InMemoryRepository) updatedComment(id, content string) (*model.Comment, error) {
+	comment, ok := r.liveComment(id)
+	if !ok {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
 	}
 
-	startIndex := 0
-	if after != nil {
-		startIndex = r.findReplyIndex(*after, replies.Edges)
-		if startIndex == -1 {
-			return nil, errors.New("invalid cursor")
-		}
-		startIndex++
+	updated := *comment
+	updated.Content = content
+	editedAt := time.Now().Format(time.RFC3339Nano)
+	updated.EditedAt = &editedAt
+
+	return &updated, nil
+}
+
+func (r *InMemoryRepository) DeleteComment(ctx context.Context, id string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deleted, tombstone, err := r.deletedComment(id)
+	if err != nil {
+		return nil, err
+	}
+	if tombstone {
+		r.putComment(deleted)
+	} else {
+		r.removeComment(r.comments[id])
 	}
 
-	endIndex := len(replies.Edges)
-	if limit > 0 && limit < len(replies.Edges)-startIndex {
-		endIndex = startIndex + limit
+	return deleted, nil
+}
+
+// deletedComment reports whether the comment stays as a tombstone because
+// it has replies, or is removed.
+func (r *InMemoryRepository) deletedComment(id string) (*model.Comment, bool, error) {
+	comment, ok := r.liveComment(id)
+	if !ok {
+		return nil, false, fmt.Errorf("comment %w", database.ErrNotFound)
 	}
 
-	var edges []*model.CommentEdge
-	for _, reply := range replies.Edges[startIndex:endIndex] {
-		if reply.Node != nil {
-			edges = append(edges, &model.CommentEdge{
-				Cursor: reply.Cursor,
-				Node:   reply.Node,
-			})
-		}
+	deleted := *comment
+	deletedAt := time.Now().Format(time.RFC3339Nano)
+	deleted.DeletedAt = &deletedAt
+
+	if len(r.replies[id]) > 0 {
+		deleted.Content = deletedContent
+		return &deleted, true, nil
 	}
 
-	hasNextPage := endIndex < len(replies.Edges)
+	return &deleted, false, nil
+}
 
-	return &model.CommentConnection{
-		Edges: edges,
-		PageInfo: &model.PageInfo{
-			EndCursor:   r.getEndCursorEdges(replies.Edges[startIndex:endIndex]),
-			HasNextPage: hasNextPage,
-		},
-	}, nil
+func (r *InMemoryRepository) LockThread(ctx context.Context, id string) (*model.Comment, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.putCommentOf(r.lockedComment(id))
+}
+
+func (r *InMemoryRepository) lockedComment(id string) (*model.Comment, error) {
+	comment, ok := r.liveComment(id)
+	if !ok {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
+	}
+
+	locked := *comment
+	locked.Locked = true
+
+	return &locked, nil
 }
@@ -2,241 +2,629 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/cursor"
 	"ozon-GraphQL/internal/database"
 	"time"
 )
 
 type PostgresSQLRepository struct {
-	db database.Database
+	db           database.Database
+	queryTimeout time.Duration
 }
 
-func NewPostgresSQLRepository(db database.Database) *PostgresSQLRepository {
-	return &PostgresSQLRepository{db: db}
+// NewPostgresSQLRepository bounds every repository call by queryTimeout on top
+// of the caller's context; zero leaves only the caller's deadline.
+func NewPostgresSQLRepository(db database.Database, queryTimeout time.Duration) *PostgresSQLRepository {
+	return &PostgresSQLRepository{db: db, queryTimeout: queryTimeout}
 }
 
-func (r *PostgresSQLRepository) CreatePost(authorID, title, content string, allowComments bool) (*model.Post, error) {
-	query := `INSERT INTO posts (author_id, title, content, allow_comments) 
-			  VALUES ($1, $2, $3, $4) RETURNING id, author_id, title, content, allow_comments`
-
-	var post model.Post
-	err := r.db.QueryRow(context.Background(), query, authorID, title, content, allowComments).Scan(
-		&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.AllowComments,
-	)
-	if err != nil {
-		return nil, err
+func (r *PostgresSQLRepository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-	return &post, nil
+	return context.WithTimeout(ctx, r.queryTimeout)
+}
+
+func (r *PostgresSQLRepository) CreatePost(ctx context.Context, authorID, title, content string, allowComments bool) (*model.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `INSERT INTO posts (author_id, title, content, allow_comments)
+			  VALUES ($1, $2, $3, $4)
+			  RETURNING id, author_id, title, content, allow_comments, created_at, edited_at, deleted_at`
+	return scanPost(r.db.QueryRow(ctx, query, authorID, title, content, allowComments))
 }
 
-func (r *PostgresSQLRepository) GetPosts(limit int, after *string) (*model.PostConnection, error) {
-	query := `SELECT id, author_id ,title, content, allow_comments FROM posts ORDER BY id LIMIT $1`
-	args := []interface{}{limit}
-	if after != nil {
-		query = `SELECT id, author_id, title, content, allow_comments FROM posts WHERE id > $2 ORDER BY id LIMIT $1`
-		args = append(args, *after)
+func (r *PostgresSQLRepository) GetPosts(ctx context.Context, page database.Page) (*model.PostConnection, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	order := sortOrder(page)
+	selectRows := `SELECT p.id, p.author_id, p.title, p.content, p.allow_comments, p.created_at, p.edited_at, p.deleted_at,
+				(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS reply_count
+			  FROM posts p WHERE p.deleted_at IS NULL`
+
+	query, args, err := keyset(postgresDialect, selectRows, []interface{}{}, page)
+	if err != nil {
+		return nil, err
 	}
 
-	rows, err := r.db.Query(context.Background(), query, args...)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var posts []*model.Post
+	var edges []*model.PostEdge
 	for rows.Next() {
-		var post model.Post
-		if err := rows.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.AllowComments); err != nil {
+		var replies int
+		post, err := scanPost(trailingRow{rows, []interface{}{&replies}})
+		if err != nil {
 			return nil, err
 		}
-		posts = append(posts, &post)
-	}
-
-	edges := make([]*model.PostEdge, len(posts))
-	for i, post := range posts {
-		edges[i] = &model.PostEdge{
-			Cursor: post.ID,
+		edges = append(edges, &model.PostEdge{
+			Cursor: cursor.Encode(postKey(post, replies, order)),
 			Node:   post,
-		}
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	var endCursor *string
+	edges, hasPreviousPage, hasNextPage := trimPage(edges, page)
+	if edges == nil {
+		edges = []*model.PostEdge{}
+	}
 
+	var startCursor, endCursor *string
 	if len(edges) > 0 {
+		startCursor = &edges[0].Cursor
 		endCursor = &edges[len(edges)-1].Cursor
 	}
 
-	hasNextPage := len(posts) == limit
+	var totalCount *int32
+	if page.WithTotalCount {
+		totalCount, err = r.count(ctx, selectRows)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &model.PostConnection{
 		Edges: edges,
 		PageInfo: &model.PageInfo{
-			EndCursor:   endCursor,
-			HasNextPage: hasNextPage,
+			StartCursor:     startCursor,
+			EndCursor:       endCursor,
+			HasPreviousPage: hasPreviousPage,
+			HasNextPage:     hasNextPage,
 		},
+		TotalCount: totalCount,
 	}, nil
 }
 
-func (r *PostgresSQLRepository) GetPostByID(id string) (*model.Post, error) {
-	query := `SELECT id, author_id, title, content, allow_comments FROM posts WHERE id = $1`
-	var post model.Post
-	err := r.db.QueryRow(context.Background(), query, id).Scan(
-		&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.AllowComments,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return &post, nil
+func (r *PostgresSQLRepository) GetPostByID(ctx context.Context, id string) (*model.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT id, author_id, title, content, allow_comments, created_at, edited_at, deleted_at FROM posts
+			  WHERE id = $1 AND deleted_at IS NULL`
+	return scanPost(r.db.QueryRow(ctx, query, id))
+}
+
+func (r *PostgresSQLRepository) UpdatePost(ctx context.Context, id string, title, content *string) (*model.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE posts SET title = COALESCE($2, title), content = COALESCE($3, content), edited_at = now()
+			  WHERE id = $1 AND deleted_at IS NULL
+			  RETURNING id, author_id, title, content, allow_comments, created_at, edited_at, deleted_at`
+	return scanPost(r.db.QueryRow(ctx, query, id, title, content))
+}
+
+func (r *PostgresSQLRepository) DeletePost(ctx context.Context, id string) (*model.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE posts SET deleted_at = now()
+			  WHERE id = $1 AND deleted_at IS NULL
+			  RETURNING id, author_id, title, content, allow_comments, created_at, edited_at, deleted_at`
+	return scanPost(r.db.QueryRow(ctx, query, id))
+}
+
+func (r *PostgresSQLRepository) SetPostCommentsEnabled(ctx context.Context, id string, enabled bool) (*model.Post, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE posts SET allow_comments = $2
+			  WHERE id = $1 AND deleted_at IS NULL
+			  RETURNING id, author_id, title, content, allow_comments, created_at, edited_at, deleted_at`
+	return scanPost(r.db.QueryRow(ctx, query, id, enabled))
 }
 
-func (r *PostgresSQLRepository) CreateComment(authorID, postID string, content string) (*model.Comment, error) {
+func (r *PostgresSQLRepository) CreateComment(ctx context.Context, authorID, postID string, content string) (*model.Comment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
 	query := `
-		INSERT INTO comments (author_id, post_id, content, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO comments (id, author_id, post_id, content, created_at, root_id, depth, path)
+		SELECT n.id, $1, $2, $3, $4, n.id, 0, comment_path_segment($4, n.id)
+		FROM (SELECT uuid_generate_v4() AS id) AS n
+		WHERE EXISTS (SELECT 1 FROM posts WHERE id = $2 AND deleted_at IS NULL)
 		RETURNING id, author_id, post_id, content, created_at
 	`
 
 	var comment model.Comment
 	var createdAt time.Time
 
-	err := r.db.QueryRow(context.Background(), query, authorID, postID, content, time.Now()).Scan(
+	err := r.db.QueryRow(ctx, query, authorID, postID, content, time.Now()).Scan(
 		&comment.ID, &comment.AuthorID, &comment.PostID, &comment.Content, &createdAt,
 	)
+	if isNotFound(err) || isForeignKeyViolation(err) {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	comment.CreatedAt = createdAt.Format(time.RFC3339)
+	comment.CreatedAt = createdAt.Format(time.RFC3339Nano)
 
 	return &comment, nil
 }
 
-func (r *PostgresSQLRepository) GetComments(postID string, limit int, after *string) (*model.CommentConnection, error) {
-	query := `SELECT id, author_id, post_id, content, created_at FROM comments WHERE post_id = $1 ORDER BY id LIMIT $2`
-	args := []interface{}{postID, limit}
-	if after != nil {
-		query = `SELECT id, author_id, post_id, content, created_at FROM comments WHERE post_id = $1 AND id > $3 ORDER BY id LIMIT $2`
-		args = append(args, *after)
+func (r *PostgresSQLRepository) GetCommentByID(ctx context.Context, id string) (*model.Comment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE c.id = $1`
+	return scanComment(r.db.QueryRow(ctx, query, id))
+}
+
+func (r *PostgresSQLRepository) GetComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.listComments(ctx, `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+				(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE c.post_id = $1 AND c.parent_id IS NULL`, postOwner, postID, page)
+}
+
+func (r *PostgresSQLRepository) GetPostComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.listComments(ctx, `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+				(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE c.post_id = $1`, postOwner, postID, page)
+}
+
+// CreateReply checks the parent and inserts the reply in one transaction, so
+// the reply's place in the tree matches the parent it was checked against.
+func (r *PostgresSQLRepository) CreateReply(ctx context.Context, authorID, postID string, content string, parentID *string) (*model.Comment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var comment model.Comment
+
+	err := database.WithTx(ctx, r.db, func(tx database.Tx) error {
+		// FOR SHARE keeps the parent from being deleted before the reply is
+		// linked to it.
+		var parentPostID string
+		err := tx.QueryRow(ctx, `SELECT post_id FROM comments WHERE id = $1 AND `+commentOfLivePost+` FOR SHARE`, parentID).Scan(&parentPostID)
+		if isNotFound(err) {
+			return fmt.Errorf("parent comment %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if parentPostID != postID {
+			return fmt.Errorf("%w: parent comment belongs to another post", database.ErrValidation)
+		}
+
+		query := `
+			INSERT INTO comments (id, author_id, post_id, content, created_at, parent_id, root_id, depth, path)
+			SELECT n.id, $1, $2, $3, $4, p.id, p.root_id, p.depth + 1, p.path || '/' || comment_path_segment($4, n.id)
+			FROM (SELECT uuid_generate_v4() AS id) AS n, comments p
+			WHERE p.id = $5
+			RETURNING id, author_id, post_id, parent_id, content, created_at
+		`
+
+		var createdAt time.Time
+		err = tx.QueryRow(ctx, query, authorID, postID, content, time.Now(), parentID).Scan(
+			&comment.ID, &comment.AuthorID, &comment.PostID, &comment.ParentID, &comment.Content, &createdAt,
+		)
+		if err != nil {
+			return err
+		}
+		comment.CreatedAt = createdAt.Format(time.RFC3339Nano)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	rows, err := r.db.Query(context.Background(), query, args...)
+	return &comment, nil
+}
+
+func (r *PostgresSQLRepository) GetRepliesByCommentID(ctx context.Context, commentID string, page database.Page) (*model.CommentConnection, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.listComments(ctx, `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+				(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE c.parent_id = $1`, commentOwner, commentID, page)
+}
+
+func (r *PostgresSQLRepository) GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, page database.Page) (map[string]*model.CommentConnection, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	if page.After != nil || page.Before != nil {
+		return nil, fmt.Errorf("%w: cursors can't be used to load replies of several comments", database.ErrValidation)
+	}
+
+	order := sortOrder(page)
+	query := `SELECT * FROM (
+				SELECT t.*,
+					ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY ` + orderColumns(page) + `) AS row_index,
+					COUNT(*) OVER (PARTITION BY parent_id) AS total_count
+				FROM (
+					SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+						(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+					FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+					WHERE c.parent_id = ANY($1)
+				) AS t
+			  ) AS w`
+	args := []interface{}{commentIDs}
+	if page.Limit > 0 {
+		query += ` WHERE row_index <= $2`
+		args = append(args, page.Limit+1)
+	}
+	query += ` ORDER BY parent_id, row_index`
+
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var comments []*model.Comment
-	var createdAt time.Time
+	edges := make(map[string][]*model.CommentEdge)
+	totals := make(map[string]int32)
 	for rows.Next() {
-		var comment model.Comment
-		if err := rows.Scan(&comment.ID, &comment.AuthorID, &comment.PostID, &comment.Content, &createdAt); err != nil {
+		var replies, rowIndex int
+		var total int32
+		reply, err := scanComment(trailingRow{rows, []interface{}{&replies, &rowIndex, &total}})
+		if err != nil {
 			return nil, err
 		}
-		comment.CreatedAt = createdAt.Format(time.RFC3339)
-		comments = append(comments, &comment)
+		edges[*reply.ParentID] = append(edges[*reply.ParentID], &model.CommentEdge{
+			Cursor: cursor.Encode(commentKey(reply, replies, order)),
+			Node:   reply,
+		})
+		totals[*reply.ParentID] = total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	edges := make([]*model.CommentEdge, len(comments))
-	for i, comment := range comments {
-		edges[i] = &model.CommentEdge{
-			Cursor: comment.ID,
-			Node:   comment,
+	conns := make(map[string]*model.CommentConnection, len(commentIDs))
+	for _, id := range commentIDs {
+		conns[id] = commentConnection(edges[id], totals[id], page)
+	}
+
+	return conns, nil
+}
+
+func (r *PostgresSQLRepository) GetCommentSubtree(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked
+			  FROM comments s JOIN posts p ON p.id = s.post_id AND p.deleted_at IS NULL
+				JOIN comments c ON c.root_id = s.root_id AND (c.id = s.id OR c.path LIKE s.path || '/%')
+			  WHERE s.id = $1
+			  ORDER BY c.path`
+
+	rows, err := r.db.Query(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*model.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
 		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil && !isNotFound(err) {
+		return nil, err
 	}
 
-	var endCursor *string
-	if len(edges) > 0 {
-		endCursor = &edges[len(edges)-1].Cursor
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
 	}
 
-	hasNextPage := len(comments) == limit
+	return comments, nil
+}
 
-	return &model.CommentConnection{
-		Edges: edges,
-		PageInfo: &model.PageInfo{
-			EndCursor:   endCursor,
-			HasNextPage: hasNextPage,
-		},
-	}, nil
+// GetCommentAncestors finds the ancestors by their paths, which are prefixes
+// of the comment's path within its root's tree.
+func (r *PostgresSQLRepository) GetCommentAncestors(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked
+			  FROM comments s JOIN posts p ON p.id = s.post_id AND p.deleted_at IS NULL
+				JOIN comments c ON c.root_id = s.root_id AND (c.id = s.id OR s.path LIKE c.path || '/%')
+			  WHERE s.id = $1
+			  ORDER BY c.depth DESC`
+
+	rows, err := r.db.Query(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*model.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
+	}
+
+	return comments, nil
 }
 
-func (r *PostgresSQLRepository) CreateReply(authorID, postID string, content string, parentID *string) (*model.Comment, error) {
-	comment, err := r.CreateComment(authorID, postID, content)
+func (r *PostgresSQLRepository) GetCommentThread(ctx context.Context, postID string, maxDepth *int, page database.Page) (*model.ThreadConnection, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	after, err := decodeThreadCursor(page)
 	if err != nil {
 		return nil, err
 	}
 
-	query := `
-		INSERT INTO replies_comments (parent_comment_id, reply_comment_id)
-		VALUES ($1, $2)
-		RETURNING parent_comment_id
-		`
+	args := []interface{}{postID}
+	conditions := "c.post_id = $1"
+	continueThread := "false"
+	if maxDepth != nil {
+		args = append(args, *maxDepth)
+		conditions += fmt.Sprintf(" AND c.depth <= $%d", len(args))
+		continueThread = fmt.Sprintf("c.depth = $%d AND EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)", len(args))
+	}
+	if page.After != nil {
+		args = append(args, after)
+		conditions += fmt.Sprintf(" AND c.path > $%d", len(args))
+	}
 
-	var createdAt time.Time
+	query := `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+				c.depth, c.path, ` + continueThread + `
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE ` + conditions + `
+			  ORDER BY c.path`
+	if page.Limit > 0 {
+		args = append(args, page.Limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
 
-	err = r.db.QueryRow(context.Background(), query, parentID, comment.ID).Scan(
-		&comment.ParentID,
-	)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	var edges []*model.ThreadEdge
+	for rows.Next() {
+		var node model.ThreadComment
+		var path string
+		node.Comment, err = scanComment(trailingRow{rows, []interface{}{&node.Depth, &path, &node.ContinueThread}})
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, &model.ThreadEdge{
+			Cursor: threadCursor(node.Comment, path),
+			Node:   &node,
+		})
+	}
+	if err := rows.Err(); err != nil && !isNotFound(err) {
+		return nil, err
+	}
+
+	if len(edges) == 0 {
+		if err := r.checkExists(ctx, postOwner, postID); err != nil {
+			return nil, err
+		}
+	}
+
+	return threadConnection(edges, page), nil
+}
 
-	comment.CreatedAt = createdAt.Format(time.RFC3339)
+func (r *PostgresSQLRepository) UpdateComment(ctx context.Context, id, content string) (*model.Comment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE comments SET content = $2, edited_at = now()
+			  WHERE id = $1 AND deleted_at IS NULL AND ` + commentOfLivePost + `
+			  RETURNING id, author_id, post_id, parent_id, content, created_at, edited_at, deleted_at, locked`
+	return scanComment(r.db.QueryRow(ctx, query, id, content))
+}
+
+func (r *PostgresSQLRepository) DeleteComment(ctx context.Context, id string) (*model.Comment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var comment *model.Comment
+
+	err := database.WithTx(ctx, r.db, func(tx database.Tx) error {
+		// CreateReply holds the parent FOR SHARE until its reply is linked,
+		// so once the lock is granted the replies check below sees every
+		// reply and none can be added before the delete.
+		var locked string
+		err := tx.QueryRow(ctx, `SELECT id FROM comments WHERE id = $1 AND `+commentOfLivePost+` FOR UPDATE`, id).Scan(&locked)
+		if isNotFound(err) {
+			return fmt.Errorf("comment %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		var hasReplies bool
+		err = tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM comments WHERE parent_id = $1)`, id,
+		).Scan(&hasReplies)
+		if err != nil {
+			return err
+		}
+
+		if hasReplies {
+			query := `UPDATE comments SET content = $2, deleted_at = now()
+					  WHERE id = $1 AND deleted_at IS NULL
+					  RETURNING id, author_id, post_id, parent_id, content, created_at, edited_at, deleted_at, locked`
+			comment, err = scanComment(tx.QueryRow(ctx, query, id, deletedContent))
+			return err
+		}
+
+		query := `DELETE FROM comments WHERE id = $1
+				  RETURNING id, author_id, post_id, parent_id, content, created_at, edited_at, now() AS deleted_at, locked`
+		comment, err = scanComment(tx.QueryRow(ctx, query, id))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	return comment, nil
 }
 
-func (r *PostgresSQLRepository) GetRepliesByCommentID(commentID string, limit int, after *string) (*model.CommentConnection, error) {
-	query := `SELECT c.id, c.author_id, c.post_id, rc.parent_comment_id, c.content, c.created_at
-			  FROM comments c JOIN replies_comments rc ON c.id = rc.reply_comment_id
-			  WHERE rc.parent_comment_id = $1 ORDER BY c.id LIMIT $2`
-	args := []interface{}{commentID, limit}
-	if after != nil {
-		query = `SELECT c.id, c.author_id, c.post_id, rc.parent_comment_id, c.content, c.created_at
-				 FROM comments c JOIN replies_comments rc ON c.id = rc.reply_comment_id
-				 WHERE rc.parent_comment_id = $1 AND c.id > $3 ORDER BY c.id LIMIT $2`
-		args = append(args, *after)
+func (r *PostgresSQLRepository) LockThread(ctx context.Context, id string) (*model.Comment, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := `UPDATE comments SET locked = true
+			  WHERE id = $1 AND ` + commentOfLivePost + `
+			  RETURNING id, author_id, post_id, parent_id, content, created_at, edited_at, deleted_at, locked`
+	return scanComment(r.db.QueryRow(ctx, query, id))
+}
+
+// listComments pages through selectRows, which must select the columns of
+// scanComment followed by reply_count and take the ID of the owner row as $1.
+// An empty page of a missing owner is reported as not found.
+func (r *PostgresSQLRepository) listComments(ctx context.Context, selectRows string, owner owner, ownerID string, page database.Page) (*model.CommentConnection, error) {
+	order := sortOrder(page)
+	query, args, err := keyset(postgresDialect, selectRows, []interface{}{ownerID}, page)
+	if err != nil {
+		return nil, err
 	}
 
-	rows, err := r.db.Query(context.Background(), query, args...)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var replies []*model.Comment
-	var createdAt time.Time
-
+	var edges []*model.CommentEdge
 	for rows.Next() {
-		var reply model.Comment
-		if err := rows.Scan(&reply.ID, &reply.AuthorID, &reply.PostID, &reply.ParentID, &reply.Content, &createdAt); err != nil {
+		var replies int
+		comment, err := scanComment(trailingRow{rows, []interface{}{&replies}})
+		if err != nil {
 			return nil, err
 		}
-
-		reply.CreatedAt = createdAt.Format(time.RFC3339)
-		replies = append(replies, &reply)
+		edges = append(edges, &model.CommentEdge{
+			Cursor: cursor.Encode(commentKey(comment, replies, order)),
+			Node:   comment,
+		})
+	}
+	if err := rows.Err(); err != nil && !isNotFound(err) {
+		return nil, err
 	}
 
-	edges := make([]*model.CommentEdge, len(replies))
-	for i, reply := range replies {
-		edges[i] = &model.CommentEdge{
-			Cursor: reply.ID,
-			Node:   reply,
+	if len(edges) == 0 {
+		if err := r.checkExists(ctx, owner, ownerID); err != nil {
+			return nil, err
 		}
 	}
 
-	var endCursor *string
+	edges, hasPreviousPage, hasNextPage := trimPage(edges, page)
+	if edges == nil {
+		edges = []*model.CommentEdge{}
+	}
+
+	var startCursor, endCursor *string
 	if len(edges) > 0 {
+		startCursor = &edges[0].Cursor
 		endCursor = &edges[len(edges)-1].Cursor
 	}
 
-	hasNextPage := len(replies) == limit
+	var totalCount *int32
+	if page.WithTotalCount {
+		totalCount, err = r.count(ctx, selectRows, ownerID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return &model.CommentConnection{
 		Edges: edges,
 		PageInfo: &model.PageInfo{
-			EndCursor:   endCursor,
-			HasNextPage: hasNextPage,
+			StartCursor:     startCursor,
+			EndCursor:       endCursor,
+			HasPreviousPage: hasPreviousPage,
+			HasNextPage:     hasNextPage,
 		},
+		TotalCount: totalCount,
 	}, nil
 }
+
+// commentOfLivePost limits an unaliased query on comments to the comments of
+// posts that aren't deleted: they are gone with their post.
+const commentOfLivePost = `EXISTS (SELECT 1 FROM posts WHERE posts.id = comments.post_id AND posts.deleted_at IS NULL)`
+
+// owner is a row that comments are listed for. Rows that don't meet
+// condition count as missing: comments of a deleted post are gone with it,
+// while a deleted comment stays as the tombstone of its replies.
+type owner struct {
+	table     string
+	name      string
+	condition string
+}
+
+var (
+	postOwner    = owner{table: "posts", name: "post", condition: "deleted_at IS NULL"}
+	commentOwner = owner{table: "comments", name: "comment", condition: commentOfLivePost}
+)
+
+func (r *PostgresSQLRepository) checkExists(ctx context.Context, owner owner, id string) error {
+	var exists bool
+	err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM `+owner.table+` WHERE id = $1 AND `+owner.condition+`)`, id).Scan(&exists)
+	if isNotFound(err) || err == nil && !exists {
+		return fmt.Errorf("%s %w", owner.name, database.ErrNotFound)
+	}
+	return err
+}
+
+func (r *PostgresSQLRepository) count(ctx context.Context, rows string, args ...interface{}) (*int32, error) {
+	var count int32
+	err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM (`+rows+`) AS t`, args...).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
@@ -0,0 +1,582 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/cursor"
+	"ozon-GraphQL/internal/database"
+	"strings"
+	"time"
+)
+
+// SQLiteRepository stores posts and comments in the schema of
+// migrations/sqlite and behaves like PostgresSQLRepository.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+var _ database.Repository = (*SQLiteRepository)(nil)
+
+func NewSQLiteRepository(db *sql.DB) *SQLiteRepository {
+	return &SQLiteRepository{db: db}
+}
+
+// SQLite has no timestamp type. Times are stored as UTC text of fixed width
+// with the precision of Postgres, so comparing them as strings orders them in
+// time.
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000Z"
+
+var sqliteDialect = dialect{
+	placeholder: func(n int) string { return fmt.Sprintf("?%d", n) },
+	timestamp:   func(t time.Time) interface{} { return t.UTC().Format(sqliteTimeFormat) },
+}
+
+func sqliteNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func parseSQLiteTime(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	t, _ := time.Parse(time.RFC3339Nano, *value)
+	formatted := t.Format(time.RFC3339Nano)
+	return &formatted
+}
+
+func scanSQLitePost(row database.Row) (*model.Post, error) {
+	var post model.Post
+	var createdAt string
+	var editedAt, deletedAt *string
+
+	err := row.Scan(&post.ID, &post.AuthorID, &post.Title, &post.Content, &post.AllowComments,
+		&createdAt, &editedAt, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	post.CreatedAt = *parseSQLiteTime(&createdAt)
+	post.EditedAt = parseSQLiteTime(editedAt)
+	post.DeletedAt = parseSQLiteTime(deletedAt)
+
+	return &post, nil
+}
+
+func scanSQLiteComment(row database.Row) (*model.Comment, error) {
+	var comment model.Comment
+	var createdAt string
+	var editedAt, deletedAt *string
+
+	err := row.Scan(&comment.ID, &comment.AuthorID, &comment.PostID, &comment.ParentID, &comment.Content,
+		&createdAt, &editedAt, &deletedAt, &comment.Locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	comment.CreatedAt = *parseSQLiteTime(&createdAt)
+	comment.EditedAt = parseSQLiteTime(editedAt)
+	comment.DeletedAt = parseSQLiteTime(deletedAt)
+
+	return &comment, nil
+}
+
+const (
+	sqlitePostColumns    = `id, author_id, title, content, allow_comments, created_at, edited_at, deleted_at`
+	sqliteCommentColumns = `id, author_id, post_id, parent_id, content, created_at, edited_at, deleted_at, locked`
+)
+
+func (r *SQLiteRepository) CreatePost(ctx context.Context, authorID, title, content string, allowComments bool) (*model.Post, error) {
+	query := `INSERT INTO posts (id, author_id, title, content, allow_comments, created_at)
+			  VALUES (?1, ?2, ?3, ?4, ?5, ?6)
+			  RETURNING ` + sqlitePostColumns
+	return scanSQLitePost(r.db.QueryRowContext(ctx, query,
+		uuid.NewString(), authorID, title, content, allowComments, sqliteDialect.timestamp(sqliteNow())))
+}
+
+func (r *SQLiteRepository) GetPosts(ctx context.Context, page database.Page) (*model.PostConnection, error) {
+	order := sortOrder(page)
+	selectRows := `SELECT p.id, p.author_id, p.title, p.content, p.allow_comments, p.created_at, p.edited_at, p.deleted_at,
+				(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS reply_count
+			  FROM posts p WHERE p.deleted_at IS NULL`
+
+	query, args, err := keyset(sqliteDialect, selectRows, []interface{}{}, page)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edges []*model.PostEdge
+	for rows.Next() {
+		var replies int
+		post, err := scanSQLitePost(trailingRow{rows, []interface{}{&replies}})
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, &model.PostEdge{
+			Cursor: cursor.Encode(postKey(post, replies, order)),
+			Node:   post,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	edges, hasPreviousPage, hasNextPage := trimPage(edges, page)
+	if edges == nil {
+		edges = []*model.PostEdge{}
+	}
+
+	var startCursor, endCursor *string
+	if len(edges) > 0 {
+		startCursor = &edges[0].Cursor
+		endCursor = &edges[len(edges)-1].Cursor
+	}
+
+	var totalCount *int32
+	if page.WithTotalCount {
+		totalCount, err = r.count(ctx, selectRows)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &model.PostConnection{
+		Edges: edges,
+		PageInfo: &model.PageInfo{
+			StartCursor:     startCursor,
+			EndCursor:       endCursor,
+			HasPreviousPage: hasPreviousPage,
+			HasNextPage:     hasNextPage,
+		},
+		TotalCount: totalCount,
+	}, nil
+}
+
+func (r *SQLiteRepository) GetPostByID(ctx context.Context, id string) (*model.Post, error) {
+	query := `SELECT ` + sqlitePostColumns + ` FROM posts WHERE id = ?1 AND deleted_at IS NULL`
+	return scanSQLitePost(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *SQLiteRepository) UpdatePost(ctx context.Context, id string, title, content *string) (*model.Post, error) {
+	query := `UPDATE posts SET title = COALESCE(?2, title), content = COALESCE(?3, content), edited_at = ?4
+			  WHERE id = ?1 AND deleted_at IS NULL
+			  RETURNING ` + sqlitePostColumns
+	return scanSQLitePost(r.db.QueryRowContext(ctx, query, id, title, content, sqliteDialect.timestamp(sqliteNow())))
+}
+
+func (r *SQLiteRepository) DeletePost(ctx context.Context, id string) (*model.Post, error) {
+	query := `UPDATE posts SET deleted_at = ?2
+			  WHERE id = ?1 AND deleted_at IS NULL
+			  RETURNING ` + sqlitePostColumns
+	return scanSQLitePost(r.db.QueryRowContext(ctx, query, id, sqliteDialect.timestamp(sqliteNow())))
+}
+
+func (r *SQLiteRepository) SetPostCommentsEnabled(ctx context.Context, id string, enabled bool) (*model.Post, error) {
+	query := `UPDATE posts SET allow_comments = ?2
+			  WHERE id = ?1 AND deleted_at IS NULL
+			  RETURNING ` + sqlitePostColumns
+	return scanSQLitePost(r.db.QueryRowContext(ctx, query, id, enabled))
+}
+
+func (r *SQLiteRepository) CreateComment(ctx context.Context, authorID, postID string, content string) (*model.Comment, error) {
+	id := uuid.NewString()
+	createdAt := sqliteNow()
+
+	// Nothing is inserted for a missing post, so there's no row to return.
+	query := `INSERT INTO comments (id, author_id, post_id, content, created_at, root_id, depth, path)
+			  SELECT ?1, ?2, p.id, ?4, ?5, ?1, 0, ?6 FROM posts p WHERE p.id = ?3 AND p.deleted_at IS NULL
+			  RETURNING ` + sqliteCommentColumns
+	comment, err := scanSQLiteComment(r.db.QueryRowContext(ctx, query, id, authorID, postID, content,
+		sqliteDialect.timestamp(createdAt), pathSegment(createdAt.Format(time.RFC3339Nano), id)))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, fmt.Errorf("post %w", database.ErrNotFound)
+	}
+	return comment, err
+}
+
+func (r *SQLiteRepository) GetCommentByID(ctx context.Context, id string) (*model.Comment, error) {
+	query := `SELECT ` + sqliteCommentColumns + ` FROM comments WHERE id = ?1 AND ` + commentOfLivePost
+	return scanSQLiteComment(r.db.QueryRowContext(ctx, query, id))
+}
+
+func (r *SQLiteRepository) GetComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
+	return r.listComments(ctx, `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+				(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE c.post_id = ?1 AND c.parent_id IS NULL`, postOwner, postID, page)
+}
+
+func (r *SQLiteRepository) GetPostComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
+	return r.listComments(ctx, `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+				(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE c.post_id = ?1`, postOwner, postID, page)
+}
+
+// CreateReply reads the parent and inserts the reply in one transaction, so
+// the reply's place in the tree matches the parent it was checked against.
+func (r *SQLiteRepository) CreateReply(ctx context.Context, authorID, postID string, content string, parentID *string) (*model.Comment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var parentPostID, rootID, parentPath string
+	var depth int
+	err = tx.QueryRowContext(ctx, `SELECT post_id, root_id, depth, path FROM comments WHERE id = ?1 AND `+commentOfLivePost, parentID).
+		Scan(&parentPostID, &rootID, &depth, &parentPath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("parent comment %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parentPostID != postID {
+		return nil, fmt.Errorf("%w: parent comment belongs to another post", database.ErrValidation)
+	}
+
+	id := uuid.NewString()
+	createdAt := sqliteNow()
+	query := `INSERT INTO comments (id, author_id, post_id, parent_id, content, created_at, root_id, depth, path)
+			  VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+			  RETURNING ` + sqliteCommentColumns
+	comment, err := scanSQLiteComment(tx.QueryRowContext(ctx, query, id, authorID, postID, parentID, content,
+		sqliteDialect.timestamp(createdAt), rootID, depth+1,
+		parentPath+"/"+pathSegment(createdAt.Format(time.RFC3339Nano), id)))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (r *SQLiteRepository) GetRepliesByCommentID(ctx context.Context, commentID string, page database.Page) (*model.CommentConnection, error) {
+	return r.listComments(ctx, `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+				(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE c.parent_id = ?1`, commentOwner, commentID, page)
+}
+
+func (r *SQLiteRepository) GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, page database.Page) (map[string]*model.CommentConnection, error) {
+	if page.After != nil || page.Before != nil {
+		return nil, fmt.Errorf("%w: cursors can't be used to load replies of several comments", database.ErrValidation)
+	}
+
+	conns := make(map[string]*model.CommentConnection, len(commentIDs))
+	if len(commentIDs) == 0 {
+		return conns, nil
+	}
+
+	args := make([]interface{}, len(commentIDs))
+	placeholders := make([]string, len(commentIDs))
+	for i, id := range commentIDs {
+		args[i] = id
+		placeholders[i] = sqliteDialect.placeholder(i + 1)
+	}
+
+	order := sortOrder(page)
+	query := `SELECT * FROM (
+				SELECT t.*,
+					ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY ` + orderColumns(page) + `) AS row_index,
+					COUNT(*) OVER (PARTITION BY parent_id) AS total_count
+				FROM (
+					SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+						(SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+					FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+					WHERE c.parent_id IN (` + strings.Join(placeholders, ", ") + `)
+				) AS t
+			  ) AS w`
+	if page.Limit > 0 {
+		args = append(args, page.Limit+1)
+		query += ` WHERE row_index <= ` + sqliteDialect.placeholder(len(args))
+	}
+	query += ` ORDER BY parent_id, row_index`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edges := make(map[string][]*model.CommentEdge)
+	totals := make(map[string]int32)
+	for rows.Next() {
+		var replies, rowIndex int
+		var total int32
+		reply, err := scanSQLiteComment(trailingRow{rows, []interface{}{&replies, &rowIndex, &total}})
+		if err != nil {
+			return nil, err
+		}
+		edges[*reply.ParentID] = append(edges[*reply.ParentID], &model.CommentEdge{
+			Cursor: cursor.Encode(commentKey(reply, replies, order)),
+			Node:   reply,
+		})
+		totals[*reply.ParentID] = total
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range commentIDs {
+		conns[id] = commentConnection(edges[id], totals[id], page)
+	}
+
+	return conns, nil
+}
+
+func (r *SQLiteRepository) GetCommentSubtree(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	query := `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked
+			  FROM comments s JOIN posts p ON p.id = s.post_id AND p.deleted_at IS NULL
+				JOIN comments c ON c.root_id = s.root_id AND (c.id = s.id OR c.path LIKE s.path || '/%')
+			  WHERE s.id = ?1
+			  ORDER BY c.path`
+
+	rows, err := r.db.QueryContext(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*model.Comment
+	for rows.Next() {
+		comment, err := scanSQLiteComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
+	}
+
+	return comments, nil
+}
+
+func (r *SQLiteRepository) GetCommentAncestors(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	query := `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked
+			  FROM comments s JOIN posts p ON p.id = s.post_id AND p.deleted_at IS NULL
+				JOIN comments c ON c.root_id = s.root_id AND (c.id = s.id OR s.path LIKE c.path || '/%')
+			  WHERE s.id = ?1
+			  ORDER BY c.depth DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*model.Comment
+	for rows.Next() {
+		comment, err := scanSQLiteComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("comment %w", database.ErrNotFound)
+	}
+
+	return comments, nil
+}
+
+func (r *SQLiteRepository) GetCommentThread(ctx context.Context, postID string, maxDepth *int, page database.Page) (*model.ThreadConnection, error) {
+	after, err := decodeThreadCursor(page)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{postID}
+	conditions := "c.post_id = ?1"
+	continueThread := "false"
+	if maxDepth != nil {
+		args = append(args, *maxDepth)
+		conditions += fmt.Sprintf(" AND c.depth <= ?%d", len(args))
+		continueThread = fmt.Sprintf("c.depth = ?%d AND EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)", len(args))
+	}
+	if page.After != nil {
+		args = append(args, after)
+		conditions += fmt.Sprintf(" AND c.path > ?%d", len(args))
+	}
+
+	query := `SELECT c.id, c.author_id, c.post_id, c.parent_id, c.content, c.created_at, c.edited_at, c.deleted_at, c.locked,
+				c.depth, c.path, ` + continueThread + `
+			  FROM comments c JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			  WHERE ` + conditions + `
+			  ORDER BY c.path`
+	if page.Limit > 0 {
+		args = append(args, page.Limit+1)
+		query += fmt.Sprintf(" LIMIT ?%d", len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edges []*model.ThreadEdge
+	for rows.Next() {
+		var node model.ThreadComment
+		var path string
+		node.Comment, err = scanSQLiteComment(trailingRow{rows, []interface{}{&node.Depth, &path, &node.ContinueThread}})
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, &model.ThreadEdge{
+			Cursor: threadCursor(node.Comment, path),
+			Node:   &node,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(edges) == 0 {
+		if err := r.checkExists(ctx, postOwner, postID); err != nil {
+			return nil, err
+		}
+	}
+
+	return threadConnection(edges, page), nil
+}
+
+func (r *SQLiteRepository) UpdateComment(ctx context.Context, id, content string) (*model.Comment, error) {
+	query := `UPDATE comments SET content = ?2, edited_at = ?3
+			  WHERE id = ?1 AND deleted_at IS NULL AND ` + commentOfLivePost + `
+			  RETURNING ` + sqliteCommentColumns
+	return scanSQLiteComment(r.db.QueryRowContext(ctx, query, id, content, sqliteDialect.timestamp(sqliteNow())))
+}
+
+func (r *SQLiteRepository) DeleteComment(ctx context.Context, id string) (*model.Comment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var hasReplies bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM comments WHERE parent_id = ?1)`, id).Scan(&hasReplies)
+	if err != nil {
+		return nil, err
+	}
+
+	deletedAt := sqliteDialect.timestamp(sqliteNow())
+	var comment *model.Comment
+	if hasReplies {
+		query := `UPDATE comments SET content = ?2, deleted_at = ?3
+				  WHERE id = ?1 AND deleted_at IS NULL AND ` + commentOfLivePost + `
+				  RETURNING ` + sqliteCommentColumns
+		comment, err = scanSQLiteComment(tx.QueryRowContext(ctx, query, id, deletedContent, deletedAt))
+	} else {
+		query := `DELETE FROM comments WHERE id = ?1 AND ` + commentOfLivePost + `
+				  RETURNING id, author_id, post_id, parent_id, content, created_at, edited_at, ?2 AS deleted_at, locked`
+		comment, err = scanSQLiteComment(tx.QueryRowContext(ctx, query, id, deletedAt))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (r *SQLiteRepository) LockThread(ctx context.Context, id string) (*model.Comment, error) {
+	query := `UPDATE comments SET locked = true WHERE id = ?1 AND ` + commentOfLivePost + ` RETURNING ` + sqliteCommentColumns
+	return scanSQLiteComment(r.db.QueryRowContext(ctx, query, id))
+}
+
+// listComments is PostgresSQLRepository.listComments for SQLite.
+func (r *SQLiteRepository) listComments(ctx context.Context, selectRows string, owner owner, ownerID string, page database.Page) (*model.CommentConnection, error) {
+	order := sortOrder(page)
+	query, args, err := keyset(sqliteDialect, selectRows, []interface{}{ownerID}, page)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edges []*model.CommentEdge
+	for rows.Next() {
+		var replies int
+		comment, err := scanSQLiteComment(trailingRow{rows, []interface{}{&replies}})
+		if err != nil {
+			return nil, err
+		}
+		edges = append(edges, &model.CommentEdge{
+			Cursor: cursor.Encode(commentKey(comment, replies, order)),
+			Node:   comment,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(edges) == 0 {
+		if err := r.checkExists(ctx, owner, ownerID); err != nil {
+			return nil, err
+		}
+	}
+
+	var total int32
+	if page.WithTotalCount {
+		count, err := r.count(ctx, selectRows, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		total = *count
+	}
+
+	return commentConnection(edges, total, page), nil
+}
+
+func (r *SQLiteRepository) checkExists(ctx context.Context, owner owner, id string) error {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+owner.table+` WHERE id = ?1 AND `+owner.condition+`)`, id).Scan(&exists)
+	if err == nil && !exists {
+		return fmt.Errorf("%s %w", owner.name, database.ErrNotFound)
+	}
+	return err
+}
+
+func (r *SQLiteRepository) count(ctx context.Context, rows string, args ...interface{}) (*int32, error) {
+	var count int32
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+rows+`) AS t`, args...).Scan(&count)
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
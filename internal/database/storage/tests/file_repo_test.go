@@ -0,0 +1,300 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hash/crc32"
+	"os"
+	"ozon-GraphQL/internal/database"
+	"ozon-GraphQL/internal/database/storage"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileRepositoryRestoresStateAfterRestart(t *testing.T) {
+	for _, snapshotEvery := range []int{0, 1, 3} {
+		dir := t.TempDir()
+		ctx := context.Background()
+
+		repo, err := storage.NewFileRepository(dir, snapshotEvery)
+		require.NoError(t, err)
+		post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
+		require.NoError(t, err)
+		root, err := repo.CreateComment(ctx, "2", post.ID, "root")
+		require.NoError(t, err)
+		reply, err := repo.CreateReply(ctx, "3", post.ID, "reply", &root.ID)
+		require.NoError(t, err)
+		leaf, err := repo.CreateReply(ctx, "3", post.ID, "leaf", &reply.ID)
+		require.NoError(t, err)
+		_, err = repo.UpdateComment(ctx, reply.ID, "edited")
+		require.NoError(t, err)
+		_, err = repo.DeleteComment(ctx, leaf.ID)
+		require.NoError(t, err)
+		_, err = repo.DeleteComment(ctx, root.ID)
+		require.NoError(t, err)
+		_, err = repo.SetPostCommentsEnabled(ctx, post.ID, false)
+		require.NoError(t, err)
+		deleted, err := repo.CreatePost(ctx, "1", "Deleted", "Content", true)
+		require.NoError(t, err)
+		_, err = repo.DeletePost(ctx, deleted.ID)
+		require.NoError(t, err)
+
+		// Reopen without Close, as after a crash.
+		reopened, err := storage.NewFileRepository(crashCopy(t, dir), snapshotEvery)
+		require.NoError(t, err)
+
+		restored, err := reopened.GetPostByID(ctx, post.ID)
+		require.NoError(t, err, snapshotEvery)
+		assert.False(t, restored.AllowComments)
+		_, err = reopened.GetPostByID(ctx, deleted.ID)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+
+		subtree, err := reopened.GetCommentSubtree(ctx, root.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"[deleted]", "edited"}, commentContents(subtree))
+		assert.NotNil(t, subtree[0].DeletedAt)
+		require.NotNil(t, subtree[1].ParentID)
+		assert.Equal(t, root.ID, *subtree[1].ParentID)
+		_, err = reopened.GetCommentByID(ctx, leaf.ID)
+		assert.ErrorIs(t, err, database.ErrNotFound)
+
+		next, err := reopened.CreateComment(ctx, "2", post.ID, "next")
+		require.NoError(t, err)
+		for _, id := range []string{post.ID, root.ID, reply.ID, leaf.ID, deleted.ID} {
+			assert.NotEqual(t, id, next.ID)
+		}
+		require.NoError(t, reopened.Close())
+		require.NoError(t, repo.Close())
+	}
+}
+
+func TestFileRepositoryCloseWritesSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	repo, err := storage.NewFileRepository(dir, 0)
+	require.NoError(t, err)
+	post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	wal, err := os.Stat(filepath.Join(dir, "wal.log"))
+	require.NoError(t, err)
+	assert.Zero(t, wal.Size())
+
+	reopened, err := storage.NewFileRepository(dir, 0)
+	require.NoError(t, err)
+	defer reopened.Close()
+	_, err = reopened.GetPostByID(ctx, post.ID)
+	assert.NoError(t, err)
+}
+
+func TestFileRepositoryDropsTornRecord(t *testing.T) {
+	for name, corrupt := range map[string]func(wal []byte) []byte{
+		"partial header": func(wal []byte) []byte {
+			return append(wal, 0, 0, 0)
+		},
+		"partial payload": func(wal []byte) []byte {
+			return append(wal, 0, 0, 0, 10, 1, 2, 3, 4, '{')
+		},
+		"checksum mismatch": func(wal []byte) []byte {
+			wal[len(wal)-2] ^= 0xff
+			return wal
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			ctx := context.Background()
+
+			repo, err := storage.NewFileRepository(dir, 0)
+			require.NoError(t, err)
+			defer repo.Close()
+			post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
+			require.NoError(t, err)
+			comment, err := repo.CreateComment(ctx, "2", post.ID, "comment")
+			require.NoError(t, err)
+
+			dir = crashCopy(t, dir)
+			path := filepath.Join(dir, "wal.log")
+			wal, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, corrupt(wal), 0o644))
+
+			reopened, err := storage.NewFileRepository(dir, 0)
+			require.NoError(t, err)
+			defer reopened.Close()
+
+			_, err = reopened.GetPostByID(ctx, post.ID)
+			require.NoError(t, err)
+			_, err = reopened.GetCommentByID(ctx, comment.ID)
+			if name == "checksum mismatch" {
+				assert.ErrorIs(t, err, database.ErrNotFound)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// The log is cut at the torn record, so new records stay readable.
+			_, err = reopened.CreateComment(ctx, "2", post.ID, "after")
+			require.NoError(t, err)
+			again, err := storage.NewFileRepository(crashCopy(t, dir), 0)
+			require.NoError(t, err)
+			defer again.Close()
+			conn, err := again.GetComments(ctx, post.ID, database.Page{Limit: 10})
+			require.NoError(t, err)
+			assert.Contains(t, contents(conn), "after")
+		})
+	}
+}
+
+func TestFileRepositoryRejectsCorruptRecordInsideLog(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	repo, err := storage.NewFileRepository(dir, 0)
+	require.NoError(t, err)
+	defer repo.Close()
+	post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	require.NoError(t, err)
+	_, err = repo.CreateComment(ctx, "2", post.ID, "comment")
+	require.NoError(t, err)
+
+	dir = crashCopy(t, dir)
+	path := filepath.Join(dir, "wal.log")
+	wal, err := os.ReadFile(path)
+	require.NoError(t, err)
+	// Flip a byte of the first record's payload; the second one is intact.
+	wal[10] ^= 0xff
+	require.NoError(t, os.WriteFile(path, wal, 0o644))
+
+	_, err = storage.NewFileRepository(dir, 0)
+	assert.ErrorContains(t, err, "followed by more records")
+
+	// Nothing was cut, so the log can still be repaired by hand.
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, wal, after)
+}
+
+func TestFileRepositoryLocksDirectory(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := storage.NewFileRepository(dir, 0)
+	require.NoError(t, err)
+
+	_, err = storage.NewFileRepository(dir, 0)
+	assert.ErrorContains(t, err, "in use")
+
+	require.NoError(t, repo.Close())
+	reopened, err := storage.NewFileRepository(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Close())
+}
+
+func TestFileRepositoryRejectsBrokenSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot.db"), []byte("garbage"), 0o644))
+
+	_, err := storage.NewFileRepository(dir, 0)
+
+	assert.Error(t, err)
+}
+
+func TestFileRepositoryThreadOrdersSiblingsByNumericID(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Siblings created within the same microsecond only differ by ID, which
+	// the log lets us set up deterministically.
+	createdAt := "2024-01-01T00:00:00Z"
+	wal := encodeRecords(t,
+		map[string]any{"op": "put_post", "post": map[string]any{"id": "1", "authorId": "1", "title": "Title", "content": "Content", "createdAt": createdAt, "allowComments": true}},
+		map[string]any{"op": "put_comment", "comment": map[string]any{"id": "9", "authorId": "2", "postId": "1", "content": "older", "createdAt": createdAt}},
+		map[string]any{"op": "put_comment", "comment": map[string]any{"id": "10", "authorId": "2", "postId": "1", "content": "newer", "createdAt": createdAt}},
+	)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "wal.log"), wal, 0o644))
+
+	repo, err := storage.NewFileRepository(dir, 0)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	var ids []string
+	page := database.Page{Limit: 1}
+	for {
+		thread, err := repo.GetCommentThread(ctx, "1", nil, page)
+		require.NoError(t, err)
+		for _, edge := range thread.Edges {
+			ids = append(ids, edge.Node.Comment.ID)
+		}
+		if !thread.PageInfo.HasNextPage {
+			break
+		}
+		page.After = thread.PageInfo.EndCursor
+	}
+
+	assert.Equal(t, []string{"9", "10"}, ids)
+}
+
+func TestFileRepositoryRejectsUnknownSnapshotVersion(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := encodeRecords(t, map[string]any{"version": 99}, map[string]any{"lastId": 0})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot.db"), snapshot, 0o644))
+
+	_, err := storage.NewFileRepository(dir, 0)
+
+	assert.ErrorContains(t, err, "version 99")
+}
+
+func TestFileRepositoryStoresRowsWithoutResolverFields(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	repo, err := storage.NewFileRepository(dir, 0)
+	require.NoError(t, err)
+	post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	require.NoError(t, err)
+	_, err = repo.CreateComment(ctx, "2", post.ID, "comment")
+	require.NoError(t, err)
+
+	wal, err := os.ReadFile(filepath.Join(dir, "wal.log"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(wal), "replies")
+
+	require.NoError(t, repo.Close())
+	snapshot, err := os.ReadFile(filepath.Join(dir, "snapshot.db"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(snapshot), "replies")
+	assert.Contains(t, string(snapshot), `{"version":1}`)
+}
+
+// encodeRecords frames records the way the log and the snapshot do.
+func encodeRecords(t *testing.T, records ...any) []byte {
+	var data []byte
+	for _, record := range records {
+		payload, err := json.Marshal(record)
+		require.NoError(t, err)
+		header := make([]byte, 8)
+		binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(header[4:8], crc32.Checksum(payload, crc32.MakeTable(crc32.Castagnoli)))
+		data = append(append(data, header...), payload...)
+	}
+	return data
+}
+
+// crashCopy copies the files of the repository in dir to a new directory, as
+// a restarted process finds them after a crash. The open repository keeps dir
+// locked, so the copy is what the tests reopen.
+func crashCopy(t *testing.T, dir string) string {
+	copied := t.TempDir()
+	for _, name := range []string{"wal.log", "snapshot.db"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(copied, name), data, 0o644))
+	}
+	return copied
+}
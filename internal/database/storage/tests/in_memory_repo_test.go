@@ -3,15 +3,19 @@
 package tests
 
 import (
+	"context"
 	"github.com/stretchr/testify/assert"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/database"
 	"ozon-GraphQL/internal/database/storage"
 	"testing"
 )
 
 func TestCreatePost(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	post, err := repo.CreatePost("1", "Title", "Content", true)
+	post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, post)
@@ -24,11 +28,12 @@ func TestCreatePost(t *testing.T) {
 
 func TestGetPosts(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	repo.CreatePost("1", "Title1", "Content1", true)
-	repo.CreatePost("2", "Title2", "Content2", false)
+	repo.CreatePost(ctx, "1", "Title1", "Content1", true)
+	repo.CreatePost(ctx, "2", "Title2", "Content2", false)
 
-	conn, err := repo.GetPosts(10, nil)
+	conn, err := repo.GetPosts(ctx, database.Page{Limit: 10})
 
 	assert.NoError(t, err)
 	assert.Len(t, conn.Edges, 2)
@@ -38,10 +43,11 @@ func TestGetPosts(t *testing.T) {
 
 func TestGetPostByID(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	post, _ := repo.CreatePost("1", "Title", "Content", true)
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
 
-	fetchedPost, err := repo.GetPostByID(post.ID)
+	fetchedPost, err := repo.GetPostByID(ctx, post.ID)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, fetchedPost)
@@ -50,10 +56,11 @@ func TestGetPostByID(t *testing.T) {
 
 func TestCreateComment(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	post, _ := repo.CreatePost("1", "Title", "Content", true)
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
 
-	comment, err := repo.CreateComment("2", post.ID, "Nice post!")
+	comment, err := repo.CreateComment(ctx, "2", post.ID, "Nice post!")
 
 	assert.NoError(t, err)
 	assert.NotNil(t, comment)
@@ -66,12 +73,13 @@ func TestCreateComment(t *testing.T) {
 
 func TestGetComments(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	post, _ := repo.CreatePost("1", "Title", "Content", true)
-	repo.CreateComment("2", post.ID, "Nice post!")
-	repo.CreateComment("3", post.ID, "I agree!")
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	repo.CreateComment(ctx, "2", post.ID, "Nice post!")
+	repo.CreateComment(ctx, "3", post.ID, "I agree!")
 
-	conn, err := repo.GetComments(post.ID, 10, nil)
+	conn, err := repo.GetComments(ctx, post.ID, database.Page{Limit: 10})
 
 	assert.NoError(t, err)
 	assert.Len(t, conn.Edges, 2)
@@ -81,11 +89,12 @@ func TestGetComments(t *testing.T) {
 
 func TestCreateReply(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	post, _ := repo.CreatePost("1", "Title", "Content", true)
-	comment, _ := repo.CreateComment("2", post.ID, "Nice post!")
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	comment, _ := repo.CreateComment(ctx, "2", post.ID, "Nice post!")
 
-	reply, err := repo.CreateReply("3", post.ID, "Thanks!", &comment.ID)
+	reply, err := repo.CreateReply(ctx, "3", post.ID, "Thanks!", &comment.ID)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, reply)
@@ -97,14 +106,32 @@ func TestCreateReply(t *testing.T) {
 	assert.NotEmpty(t, reply.CreatedAt)
 }
 
+func TestCreateReplyToCommentOfAnotherPost(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	other, _ := repo.CreatePost(ctx, "1", "Other", "Content", true)
+	repo.CreateComment(ctx, "2", other.ID, "First")
+	parent, _ := repo.CreateComment(ctx, "2", other.ID, "Second")
+	missing := "missing"
+
+	_, err := repo.CreateReply(ctx, "3", post.ID, "Thanks!", &parent.ID)
+	assert.ErrorIs(t, err, database.ErrValidation)
+
+	_, err = repo.CreateReply(ctx, "3", post.ID, "Thanks!", &missing)
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
+
 func TestGetRepliesByCommentID(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	post, _ := repo.CreatePost("1", "Title", "Content", true)
-	comment, _ := repo.CreateComment("2", post.ID, "Nice post!")
-	repo.CreateReply("3", post.ID, "Thanks!", &comment.ID)
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	comment, _ := repo.CreateComment(ctx, "2", post.ID, "Nice post!")
+	repo.CreateReply(ctx, "3", post.ID, "Thanks!", &comment.ID)
 
-	conn, err := repo.GetRepliesByCommentID(comment.ID, 10, nil)
+	conn, err := repo.GetRepliesByCommentID(ctx, comment.ID, database.Page{Limit: 10})
 
 	assert.NoError(t, err)
 	assert.Len(t, conn.Edges, 1)
@@ -113,12 +140,13 @@ func TestGetRepliesByCommentID(t *testing.T) {
 
 func TestGetPostsWithPagination(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	repo.CreatePost("1", "Title1", "Content1", true)
-	repo.CreatePost("2", "Title2", "Content2", false)
-	repo.CreatePost("3", "Title3", "Content3", true)
+	repo.CreatePost(ctx, "1", "Title1", "Content1", true)
+	repo.CreatePost(ctx, "2", "Title2", "Content2", false)
+	repo.CreatePost(ctx, "3", "Title3", "Content3", true)
 
-	conn, err := repo.GetPosts(2, nil)
+	conn, err := repo.GetPosts(ctx, database.Page{Limit: 2})
 
 	assert.NoError(t, err)
 	assert.Len(t, conn.Edges, 2)
@@ -126,7 +154,7 @@ func TestGetPostsWithPagination(t *testing.T) {
 	assert.Equal(t, "Title2", conn.Edges[1].Node.Title)
 
 	after := conn.PageInfo.EndCursor
-	conn, err = repo.GetPosts(2, after)
+	conn, err = repo.GetPosts(ctx, database.Page{Limit: 2, After: after})
 
 	assert.NoError(t, err)
 	assert.Len(t, conn.Edges, 1)
@@ -135,13 +163,14 @@ func TestGetPostsWithPagination(t *testing.T) {
 
 func TestGetCommentsWithPagination(t *testing.T) {
 	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
 
-	post, _ := repo.CreatePost("1", "Title", "Content", true)
-	repo.CreateComment("2", post.ID, "Nice post!")
-	repo.CreateComment("3", post.ID, "I agree!")
-	repo.CreateComment("4", post.ID, "Thanks!")
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	repo.CreateComment(ctx, "2", post.ID, "Nice post!")
+	repo.CreateComment(ctx, "3", post.ID, "I agree!")
+	repo.CreateComment(ctx, "4", post.ID, "Thanks!")
 
-	conn, err := repo.GetComments(post.ID, 2, nil)
+	conn, err := repo.GetComments(ctx, post.ID, database.Page{Limit: 2})
 
 	assert.NoError(t, err)
 	assert.Len(t, conn.Edges, 2)
@@ -149,9 +178,366 @@ func TestGetCommentsWithPagination(t *testing.T) {
 	assert.Equal(t, "I agree!", conn.Edges[1].Node.Content)
 
 	after := conn.PageInfo.EndCursor
-	conn, err = repo.GetComments(post.ID, 2, after)
+	conn, err = repo.GetComments(ctx, post.ID, database.Page{Limit: 2, After: after})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 1)
+	assert.Equal(t, "Thanks!", conn.Edges[0].Node.Content)
+}
+
+func TestUpdatePost(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+
+	title := "New title"
+	updated, err := repo.UpdatePost(ctx, post.ID, &title, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "New title", updated.Title)
+	assert.Equal(t, "Content", updated.Content)
+	assert.NotNil(t, updated.EditedAt)
+}
+
+func TestDeletePost(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+
+	deleted, err := repo.DeletePost(ctx, post.ID)
 
+	assert.NoError(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+
+	_, err = repo.GetPostByID(ctx, post.ID)
+	assert.Error(t, err)
+
+	conn, err := repo.GetPosts(ctx, database.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 0)
+}
+
+func TestDeleteCommentWithRepliesLeavesTombstone(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	comment, _ := repo.CreateComment(ctx, "2", post.ID, "Nice post!")
+	repo.CreateReply(ctx, "3", post.ID, "Thanks!", &comment.ID)
+
+	deleted, err := repo.DeleteComment(ctx, comment.ID)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "[deleted]", deleted.Content)
+	assert.NotNil(t, deleted.DeletedAt)
+
+	conn, err := repo.GetRepliesByCommentID(ctx, comment.ID, database.Page{Limit: 10})
 	assert.NoError(t, err)
 	assert.Len(t, conn.Edges, 1)
 	assert.Equal(t, "Thanks!", conn.Edges[0].Node.Content)
 }
+
+func TestDeleteCommentWithoutReplies(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	comment, _ := repo.CreateComment(ctx, "2", post.ID, "Nice post!")
+	reply, _ := repo.CreateReply(ctx, "3", post.ID, "Thanks!", &comment.ID)
+
+	_, err := repo.DeleteComment(ctx, reply.ID)
+
+	assert.NoError(t, err)
+
+	_, err = repo.GetCommentByID(ctx, reply.ID)
+	assert.Error(t, err)
+
+	conn, err := repo.GetRepliesByCommentID(ctx, comment.ID, database.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 0)
+}
+
+func TestGetPostsWithInvalidCursor(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	repo.CreatePost(ctx, "1", "Title1", "Content1", true)
+
+	after := "1"
+	_, err := repo.GetPosts(ctx, database.Page{Limit: 10, After: &after})
+
+	assert.Error(t, err)
+}
+
+func TestGetPostsExactPageHasNoNextPage(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	repo.CreatePost(ctx, "1", "Title1", "Content1", true)
+	repo.CreatePost(ctx, "2", "Title2", "Content2", true)
+
+	conn, err := repo.GetPosts(ctx, database.Page{Limit: 2})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 2)
+	assert.False(t, conn.PageInfo.HasNextPage)
+	assert.False(t, conn.PageInfo.HasPreviousPage)
+	assert.Equal(t, conn.Edges[0].Cursor, *conn.PageInfo.StartCursor)
+}
+
+func TestGetPostsBackward(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	repo.CreatePost(ctx, "1", "Title1", "Content1", true)
+	repo.CreatePost(ctx, "2", "Title2", "Content2", true)
+	repo.CreatePost(ctx, "3", "Title3", "Content3", true)
+
+	conn, err := repo.GetPosts(ctx, database.Page{Limit: 2, Backward: true, WithTotalCount: true})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 2)
+	assert.Equal(t, "Title2", conn.Edges[0].Node.Title)
+	assert.Equal(t, "Title3", conn.Edges[1].Node.Title)
+	assert.True(t, conn.PageInfo.HasPreviousPage)
+	assert.False(t, conn.PageInfo.HasNextPage)
+	assert.Equal(t, int32(3), *conn.TotalCount)
+
+	conn, err = repo.GetPosts(ctx, database.Page{Limit: 2, Backward: true, Before: conn.PageInfo.StartCursor})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 1)
+	assert.Equal(t, "Title1", conn.Edges[0].Node.Title)
+	assert.False(t, conn.PageInfo.HasPreviousPage)
+	assert.True(t, conn.PageInfo.HasNextPage)
+	assert.Nil(t, conn.TotalCount)
+}
+
+func TestGetPostsNewestFirst(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	repo.CreatePost(ctx, "1", "Title1", "Content1", true)
+	repo.CreatePost(ctx, "2", "Title2", "Content2", true)
+	repo.CreatePost(ctx, "3", "Title3", "Content3", true)
+
+	conn, err := repo.GetPosts(ctx, database.Page{Limit: 2, Order: model.SortOrderNewest})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 2)
+	assert.Equal(t, "Title3", conn.Edges[0].Node.Title)
+	assert.Equal(t, "Title2", conn.Edges[1].Node.Title)
+
+	conn, err = repo.GetPosts(ctx, database.Page{Limit: 2, After: conn.PageInfo.EndCursor, Order: model.SortOrderNewest})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 1)
+	assert.Equal(t, "Title1", conn.Edges[0].Node.Title)
+	assert.False(t, conn.PageInfo.HasNextPage)
+}
+
+func TestGetPostsSkipsPostDeletedBetweenPages(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	repo.CreatePost(ctx, "1", "Title1", "Content1", true)
+	second, _ := repo.CreatePost(ctx, "2", "Title2", "Content2", true)
+	repo.CreatePost(ctx, "3", "Title3", "Content3", true)
+
+	conn, err := repo.GetPosts(ctx, database.Page{Limit: 1, Order: model.SortOrderNewest})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Title3", conn.Edges[0].Node.Title)
+
+	_, err = repo.DeletePost(ctx, second.ID)
+	assert.NoError(t, err)
+
+	conn, err = repo.GetPosts(ctx, database.Page{Limit: 1, After: conn.PageInfo.EndCursor, Order: model.SortOrderNewest, WithTotalCount: true})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 1)
+	assert.Equal(t, "Title1", conn.Edges[0].Node.Title)
+	assert.False(t, conn.PageInfo.HasNextPage)
+	assert.Equal(t, int32(2), *conn.TotalCount)
+}
+
+func TestGetCommentsMostReplies(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	quiet, _ := repo.CreateComment(ctx, "2", post.ID, "quiet")
+	busy, _ := repo.CreateComment(ctx, "3", post.ID, "busy")
+	repo.CreateComment(ctx, "3", post.ID, "silent")
+	repo.CreateReply(ctx, "4", post.ID, "reply1", &busy.ID)
+	repo.CreateReply(ctx, "4", post.ID, "reply2", &busy.ID)
+	repo.CreateReply(ctx, "4", post.ID, "reply3", &quiet.ID)
+
+	conn, err := repo.GetComments(ctx, post.ID, database.Page{Limit: 2, Order: model.SortOrderMostReplies})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 2)
+	assert.Equal(t, "busy", conn.Edges[0].Node.Content)
+	assert.Equal(t, "quiet", conn.Edges[1].Node.Content)
+
+	// A reply to an already listed comment moves it up, but the next page
+	// still continues from the cursor's position.
+	repo.CreateReply(ctx, "4", post.ID, "reply4", &quiet.ID)
+	repo.CreateReply(ctx, "4", post.ID, "reply5", &quiet.ID)
+
+	conn, err = repo.GetComments(ctx, post.ID, database.Page{Limit: 10, After: conn.PageInfo.EndCursor, Order: model.SortOrderMostReplies})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 1)
+	assert.Equal(t, "silent", conn.Edges[0].Node.Content)
+}
+
+func TestGetPostsRejectsCursorOfAnotherOrder(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	repo.CreatePost(ctx, "1", "Title1", "Content1", true)
+	repo.CreatePost(ctx, "2", "Title2", "Content2", true)
+
+	conn, err := repo.GetPosts(ctx, database.Page{Limit: 1, Order: model.SortOrderNewest})
+	assert.NoError(t, err)
+
+	_, err = repo.GetPosts(ctx, database.Page{Limit: 1, After: conn.PageInfo.EndCursor, Order: model.SortOrderOldest})
+
+	assert.Error(t, err)
+}
+
+func TestGetRepliesByCommentIDs(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	first, _ := repo.CreateComment(ctx, "2", post.ID, "first")
+	second, _ := repo.CreateComment(ctx, "2", post.ID, "second")
+	repo.CreateReply(ctx, "3", post.ID, "reply1", &first.ID)
+	repo.CreateReply(ctx, "3", post.ID, "reply2", &first.ID)
+	repo.CreateReply(ctx, "3", post.ID, "reply3", &second.ID)
+
+	conns, err := repo.GetRepliesByCommentIDs(ctx, []string{first.ID, second.ID, "missing"}, database.Page{Limit: 1, WithTotalCount: true})
+
+	assert.NoError(t, err)
+	assert.Len(t, conns, 3)
+	assert.Equal(t, "reply1", conns[first.ID].Edges[0].Node.Content)
+	assert.True(t, conns[first.ID].PageInfo.HasNextPage)
+	assert.Equal(t, int32(2), *conns[first.ID].TotalCount)
+	assert.Equal(t, "reply3", conns[second.ID].Edges[0].Node.Content)
+	assert.False(t, conns[second.ID].PageInfo.HasNextPage)
+	assert.Empty(t, conns["missing"].Edges)
+}
+
+func TestGetCommentSubtree(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	root, _ := repo.CreateComment(ctx, "2", post.ID, "root")
+	first, _ := repo.CreateReply(ctx, "3", post.ID, "first", &root.ID)
+	second, _ := repo.CreateReply(ctx, "3", post.ID, "second", &root.ID)
+	repo.CreateReply(ctx, "4", post.ID, "first nested", &first.ID)
+	repo.CreateReply(ctx, "4", post.ID, "second nested", &second.ID)
+	repo.CreateComment(ctx, "2", post.ID, "other root")
+
+	subtree, err := repo.GetCommentSubtree(ctx, root.ID)
+
+	assert.NoError(t, err)
+	var contents []string
+	for _, comment := range subtree {
+		contents = append(contents, comment.Content)
+	}
+	assert.Equal(t, []string{"root", "first", "first nested", "second", "second nested"}, contents)
+
+	_, err = repo.GetCommentSubtree(ctx, "missing")
+
+	assert.Error(t, err)
+}
+
+func TestGetCommentThread(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	root, _ := repo.CreateComment(ctx, "2", post.ID, "root")
+	reply, _ := repo.CreateReply(ctx, "3", post.ID, "reply", &root.ID)
+	repo.CreateReply(ctx, "4", post.ID, "nested", &reply.ID)
+	repo.CreateComment(ctx, "2", post.ID, "other root")
+
+	maxDepth := 1
+	conn, err := repo.GetCommentThread(ctx, post.ID, &maxDepth, database.Page{Limit: 2})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 2)
+	assert.Equal(t, "root", conn.Edges[0].Node.Comment.Content)
+	assert.Equal(t, int32(0), conn.Edges[0].Node.Depth)
+	assert.False(t, conn.Edges[0].Node.ContinueThread)
+	assert.Equal(t, "reply", conn.Edges[1].Node.Comment.Content)
+	assert.Equal(t, int32(1), conn.Edges[1].Node.Depth)
+	assert.True(t, conn.Edges[1].Node.ContinueThread)
+	assert.True(t, conn.PageInfo.HasNextPage)
+
+	conn, err = repo.GetCommentThread(ctx, post.ID, &maxDepth, database.Page{Limit: 2, After: conn.PageInfo.EndCursor})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 1)
+	assert.Equal(t, "other root", conn.Edges[0].Node.Comment.Content)
+	assert.False(t, conn.PageInfo.HasNextPage)
+
+	conn, err = repo.GetCommentThread(ctx, post.ID, nil, database.Page{})
+
+	assert.NoError(t, err)
+	assert.Len(t, conn.Edges, 4)
+	assert.Equal(t, "nested", conn.Edges[2].Node.Comment.Content)
+	assert.Equal(t, int32(2), conn.Edges[2].Node.Depth)
+}
+
+func TestCommentIDsAreUniqueAcrossPosts(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	first, _ := repo.CreatePost(ctx, "1", "First", "Content", true)
+	second, _ := repo.CreatePost(ctx, "1", "Second", "Content", true)
+	onFirst, _ := repo.CreateComment(ctx, "2", first.ID, "On first")
+	onSecond, _ := repo.CreateComment(ctx, "2", second.ID, "On second")
+
+	assert.NotEqual(t, onFirst.ID, onSecond.ID)
+
+	_, err := repo.CreateReply(ctx, "3", second.ID, "Reply", &onSecond.ID)
+	assert.NoError(t, err)
+
+	firstReplies, err := repo.GetRepliesByCommentID(ctx, onFirst.ID, database.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Empty(t, firstReplies.Edges)
+
+	secondReplies, err := repo.GetRepliesByCommentID(ctx, onSecond.ID, database.Page{Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, secondReplies.Edges, 1)
+}
+
+func TestIDsAreNotReusedAfterDelete(t *testing.T) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+
+	post, _ := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	repo.CreateComment(ctx, "2", post.ID, "First")
+	second, _ := repo.CreateComment(ctx, "2", post.ID, "Second")
+
+	_, err := repo.DeleteComment(ctx, second.ID)
+	assert.NoError(t, err)
+
+	third, _ := repo.CreateComment(ctx, "2", post.ID, "Third")
+	assert.NotEqual(t, second.ID, third.ID)
+
+	_, err = repo.GetCommentByID(ctx, second.ID)
+	assert.ErrorIs(t, err, database.ErrNotFound)
+
+	deletedPost, _ := repo.CreatePost(ctx, "1", "Deleted", "Content", true)
+	repo.DeletePost(ctx, deletedPost.ID)
+	newPost, _ := repo.CreatePost(ctx, "1", "New", "Content", true)
+	assert.NotEqual(t, deletedPost.ID, newPost.ID)
+}
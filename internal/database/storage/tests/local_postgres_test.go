@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// postgresURL returns TEST_DATABASE_URL or, failing that, starts a throwaway
+// server from the initdb and pg_ctl binaries in POSTGRES_BIN or PATH. The
+// server lives in a temporary directory and is stopped when the test ends.
+func postgresURL(t *testing.T) string {
+	t.Helper()
+
+	if url := os.Getenv("TEST_DATABASE_URL"); url != "" {
+		return url
+	}
+
+	initdb, pgCtl := postgresBinary("initdb"), postgresBinary("pg_ctl")
+	if initdb == "" || pgCtl == "" {
+		t.Skip("neither TEST_DATABASE_URL nor the Postgres binaries are available")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("Postgres refuses to run as root, set TEST_DATABASE_URL instead")
+	}
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	run(t, initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync")
+
+	port := freePort(t)
+	run(t, pgCtl, "start", "-w", "-D", data, "-l", filepath.Join(dir, "postgres.log"),
+		"-o", fmt.Sprintf("-p %d -k %s -h 127.0.0.1 -F", port, dir))
+	t.Cleanup(func() {
+		exec.Command(pgCtl, "stop", "-w", "-D", data, "-m", "immediate").Run()
+	})
+
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port)
+}
+
+func postgresBinary(name string) string {
+	if dir := os.Getenv("POSTGRES_BIN"); dir != "" {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		return ""
+	}
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func run(t *testing.T, name string, args ...string) {
+	t.Helper()
+
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", filepath.Base(name), err, out)
+	}
+}
@@ -1,11 +1,17 @@
 package tests
 
 import (
+	"context"
+	"errors"
 	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/stretchr/testify/assert"
+	"ozon-GraphQL/internal/database"
 	"ozon-GraphQL/internal/database/storage"
 	"ozon-GraphQL/internal/database/storage/mocks"
 	"testing"
+	"time"
 )
 
 func TestPostgresCreatePost(t *testing.T) {
@@ -14,7 +20,8 @@ func TestPostgresCreatePost(t *testing.T) {
 
 	mockDB := mocks.NewMockDatabase(ctrl)
 
-	repo := storage.NewPostgresSQLRepository(mockDB)
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
 
 	authorID := "author123"
 	title := "Test Post"
@@ -28,6 +35,9 @@ func TestPostgresCreatePost(t *testing.T) {
 		gomock.Any(), // title
 		gomock.Any(), // content
 		gomock.Any(), // allow_comments
+		gomock.Any(), // created_at
+		gomock.Any(), // edited_at
+		gomock.Any(), // deleted_at
 	).Return(nil).Times(1)
 
 	mockDB.EXPECT().
@@ -35,7 +45,7 @@ func TestPostgresCreatePost(t *testing.T) {
 		Return(mockRow).
 		Times(1)
 
-	_, err := repo.CreatePost(authorID, title, content, allowComments)
+	_, err := repo.CreatePost(ctx, authorID, title, content, allowComments)
 
 	assert.NoError(t, err, "Expected no error")
 }
@@ -46,19 +56,20 @@ func TestPostgresGetPostByID(t *testing.T) {
 
 	mockDB := mocks.NewMockDatabase(ctrl)
 
-	repo := storage.NewPostgresSQLRepository(mockDB)
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
 
 	postID := "post123"
 
 	mockRow := mocks.NewMockRow(ctrl)
-	mockRow.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+	mockRow.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
 
 	mockDB.EXPECT().
 		QueryRow(gomock.Any(), gomock.Any(), postID).
 		Return(mockRow).
 		Times(1)
 
-	_, err := repo.GetPostByID(postID)
+	_, err := repo.GetPostByID(ctx, postID)
 
 	assert.NoError(t, err, "Expected no error")
 }
@@ -69,7 +80,8 @@ func TestPostgresCreateComment(t *testing.T) {
 
 	mockDB := mocks.NewMockDatabase(ctrl)
 
-	repo := storage.NewPostgresSQLRepository(mockDB)
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
 
 	authorID := "author123"
 	postID := "post123"
@@ -83,7 +95,253 @@ func TestPostgresCreateComment(t *testing.T) {
 		Return(mockRow).
 		Times(1)
 
-	_, err := repo.CreateComment(authorID, postID, content)
+	_, err := repo.CreateComment(ctx, authorID, postID, content)
+
+	assert.NoError(t, err, "Expected no error")
+}
+
+func TestPostgresCreateCommentOnMissingPost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
+
+	mockRow := mocks.NewMockRow(ctrl)
+	mockRow.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&pgconn.PgError{Code: "23503"}).
+		Times(1)
+
+	mockDB.EXPECT().
+		QueryRow(gomock.Any(), gomock.Any(), "author123", "post123", "comment", gomock.Any()).
+		Return(mockRow).
+		Times(1)
+
+	_, err := repo.CreateComment(ctx, "author123", "post123", "comment")
+
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
+
+func TestPostgresGetPostByMalformedID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
+
+	mockRow := mocks.NewMockRow(ctrl)
+	mockRow.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&pgconn.PgError{Code: "22P02"}).
+		Times(1)
+
+	mockDB.EXPECT().
+		QueryRow(gomock.Any(), gomock.Any(), "missing").
+		Return(mockRow).
+		Times(1)
+
+	_, err := repo.GetPostByID(ctx, "missing")
+
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
+
+func TestPostgresDeleteCommentWithReplies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockTx := mocks.NewMockTx(ctrl)
+
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
+
+	commentID := "comment123"
+
+	lockRow := mocks.NewMockRow(ctrl)
+	lockRow.EXPECT().Scan(gomock.Any()).SetArg(0, commentID).Return(nil).Times(1)
+
+	existsRow := mocks.NewMockRow(ctrl)
+	existsRow.EXPECT().Scan(gomock.Any()).SetArg(0, true).Return(nil).Times(1)
+
+	mockRow := mocks.NewMockRow(ctrl)
+	mockRow.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	gomock.InOrder(
+		mockDB.EXPECT().Begin(gomock.Any()).Return(mockTx, nil),
+		mockTx.EXPECT().
+			QueryRow(gomock.Any(), gomock.Any(), commentID).
+			DoAndReturn(func(ctx context.Context, query string, args ...interface{}) pgx.Row {
+				assert.Contains(t, query, "FOR UPDATE")
+				return lockRow
+			}),
+		mockTx.EXPECT().
+			QueryRow(gomock.Any(), gomock.Any(), commentID).
+			Return(existsRow),
+		mockTx.EXPECT().
+			QueryRow(gomock.Any(), gomock.Any(), commentID, "[deleted]").
+			Return(mockRow),
+		mockTx.EXPECT().Commit(gomock.Any()).Return(nil),
+	)
+
+	_, err := repo.DeleteComment(ctx, commentID)
+
+	assert.NoError(t, err, "Expected no error")
+}
+
+func TestPostgresDeleteMissingComment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockTx := mocks.NewMockTx(ctrl)
+
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
+
+	lockRow := mocks.NewMockRow(ctrl)
+	lockRow.EXPECT().Scan(gomock.Any()).Return(pgx.ErrNoRows).Times(1)
+
+	gomock.InOrder(
+		mockDB.EXPECT().Begin(gomock.Any()).Return(mockTx, nil),
+		mockTx.EXPECT().QueryRow(gomock.Any(), gomock.Any(), "missing").Return(lockRow),
+		mockTx.EXPECT().Rollback(gomock.Any()).Return(nil),
+	)
+
+	_, err := repo.DeleteComment(ctx, "missing")
+
+	assert.ErrorIs(t, err, database.ErrNotFound)
+}
+
+type requestKey struct{}
+
+func TestPostgresQueryTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+
+	repo := storage.NewPostgresSQLRepository(mockDB, time.Second)
+	ctx := context.WithValue(context.Background(), requestKey{}, "request")
+
+	mockRow := mocks.NewMockRow(ctrl)
+	mockRow.EXPECT().Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+	mockDB.EXPECT().
+		QueryRow(gomock.Any(), gomock.Any(), "post123").
+		DoAndReturn(func(queryCtx context.Context, query string, args ...interface{}) pgx.Row {
+			deadline, ok := queryCtx.Deadline()
+			assert.True(t, ok, "Expected the query to have a deadline")
+			assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond)
+			assert.Equal(t, "request", queryCtx.Value(requestKey{}), "Expected the caller's context to be passed through")
+			return mockRow
+		}).
+		Times(1)
+
+	_, err := repo.GetPostByID(ctx, "post123")
+
+	assert.NoError(t, err, "Expected no error")
+}
+
+func TestPostgresCreateReply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockTx := mocks.NewMockTx(ctrl)
+
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
+
+	parentID := "parent123"
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	parentRow := mocks.NewMockRow(ctrl)
+	parentRow.EXPECT().Scan(gomock.Any()).SetArg(0, "post123").Return(nil)
+
+	insertRow := mocks.NewMockRow(ctrl)
+	insertRow.EXPECT().
+		Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(dest ...interface{}) error {
+			*dest[0].(*string) = "reply123"
+			*dest[3].(**string) = &parentID
+			*dest[5].(*time.Time) = createdAt
+			return nil
+		})
+
+	gomock.InOrder(
+		mockDB.EXPECT().Begin(gomock.Any()).Return(mockTx, nil),
+		mockTx.EXPECT().QueryRow(gomock.Any(), gomock.Any(), &parentID).Return(parentRow),
+		mockTx.EXPECT().QueryRow(gomock.Any(), gomock.Any(), "author123", "post123", "hi", gomock.Any(), &parentID).Return(insertRow),
+		mockTx.EXPECT().Commit(gomock.Any()).Return(nil),
+	)
+
+	reply, err := repo.CreateReply(ctx, "author123", "post123", "hi", &parentID)
 
 	assert.NoError(t, err, "Expected no error")
+	assert.Equal(t, "reply123", reply.ID)
+	assert.Equal(t, &parentID, reply.ParentID)
+	assert.Equal(t, createdAt.Format(time.RFC3339Nano), reply.CreatedAt)
+}
+
+func TestPostgresCreateReplyParentOnAnotherPost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockTx := mocks.NewMockTx(ctrl)
+
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
+
+	parentID := "parent123"
+
+	parentRow := mocks.NewMockRow(ctrl)
+	parentRow.EXPECT().Scan(gomock.Any()).SetArg(0, "otherPost").Return(nil)
+
+	gomock.InOrder(
+		mockDB.EXPECT().Begin(gomock.Any()).Return(mockTx, nil),
+		mockTx.EXPECT().QueryRow(gomock.Any(), gomock.Any(), &parentID).Return(parentRow),
+		mockTx.EXPECT().Rollback(gomock.Any()).Return(nil),
+	)
+
+	_, err := repo.CreateReply(ctx, "author123", "post123", "hi", &parentID)
+
+	assert.ErrorIs(t, err, database.ErrValidation)
+}
+
+func TestPostgresCreateReplyRollsBackFailedInsert(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockTx := mocks.NewMockTx(ctrl)
+
+	repo := storage.NewPostgresSQLRepository(mockDB, 0)
+	ctx := context.Background()
+
+	parentID := "parent123"
+
+	parentRow := mocks.NewMockRow(ctrl)
+	parentRow.EXPECT().Scan(gomock.Any()).SetArg(0, "post123").Return(nil)
+
+	insertErr := errors.New("insert failed")
+
+	insertRow := mocks.NewMockRow(ctrl)
+	insertRow.EXPECT().
+		Scan(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(insertErr)
+
+	gomock.InOrder(
+		mockDB.EXPECT().Begin(gomock.Any()).Return(mockTx, nil),
+		mockTx.EXPECT().QueryRow(gomock.Any(), gomock.Any(), &parentID).Return(parentRow),
+		mockTx.EXPECT().QueryRow(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(insertRow),
+		mockTx.EXPECT().Rollback(gomock.Any()).Return(nil),
+	)
+
+	_, err := repo.CreateReply(ctx, "author123", "post123", "hi", &parentID)
+
+	assert.ErrorIs(t, err, insertErr)
 }
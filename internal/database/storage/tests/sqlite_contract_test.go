@@ -0,0 +1,32 @@
+//go:build cgo
+
+package tests
+
+import (
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite3"
+	"github.com/stretchr/testify/require"
+	"ozon-GraphQL/internal/database"
+	"ozon-GraphQL/internal/database/storage"
+	"path/filepath"
+	"testing"
+)
+
+// The SQLite driver needs cgo, hence the build constraint.
+func TestSQLiteRepositoryContract(t *testing.T) {
+	runRepositoryContract(t, func(t *testing.T) database.Repository {
+		path := filepath.Join(t.TempDir(), "test.db")
+
+		m, err := migrate.New("file://../../../../migrations/sqlite", "sqlite3://"+path)
+		require.NoError(t, err)
+		require.NoError(t, m.Up())
+		srcErr, dbErr := m.Close()
+		require.NoError(t, srcErr)
+		require.NoError(t, dbErr)
+
+		db, err := database.OpenSQLite(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		return storage.NewSQLiteRepository(db)
+	})
+}
@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-GraphQL/internal/database"
+	"testing"
+	"time"
+)
+
+const connStr = "user=test password=test dbname=test host=localhost port=5432 sslmode=disable"
+
+func TestNewPoolConfig(t *testing.T) {
+	cfg, err := database.NewPoolConfig(connStr, database.PoolConfig{
+		MinConns:          2,
+		MaxConns:          20,
+		MaxConnIdleTime:   time.Minute,
+		HealthCheckPeriod: 15 * time.Second,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), cfg.MinConns)
+	assert.Equal(t, int32(20), cfg.MaxConns)
+	assert.Equal(t, time.Minute, cfg.MaxConnIdleTime)
+	assert.Equal(t, 15*time.Second, cfg.HealthCheckPeriod)
+}
+
+func TestNewPoolConfigKeepsDefaults(t *testing.T) {
+	defaults, err := database.NewPoolConfig(connStr, database.PoolConfig{})
+	require.NoError(t, err)
+
+	assert.Positive(t, defaults.MaxConns)
+	assert.Positive(t, defaults.MaxConnIdleTime)
+	assert.Positive(t, defaults.HealthCheckPeriod)
+}
+
+func TestNewPoolConfigRejectsMinAboveMax(t *testing.T) {
+	_, err := database.NewPoolConfig(connStr, database.PoolConfig{MinConns: 10, MaxConns: 5})
+
+	assert.Error(t, err)
+}
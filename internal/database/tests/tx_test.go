@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"ozon-GraphQL/internal/database"
+	"ozon-GraphQL/internal/database/storage/mocks"
+	"testing"
+)
+
+func TestWithTxCommits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockTx := mocks.NewMockTx(ctrl)
+
+	gomock.InOrder(
+		mockDB.EXPECT().Begin(gomock.Any()).Return(mockTx, nil),
+		mockTx.EXPECT().Commit(gomock.Any()).Return(nil),
+	)
+
+	err := database.WithTx(context.Background(), mockDB, func(tx database.Tx) error {
+		assert.Equal(t, mockTx, tx)
+		return nil
+	})
+
+	assert.NoError(t, err)
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	mockTx := mocks.NewMockTx(ctrl)
+	failure := errors.New("failure")
+
+	gomock.InOrder(
+		mockDB.EXPECT().Begin(gomock.Any()).Return(mockTx, nil),
+		mockTx.EXPECT().Rollback(gomock.Any()).Return(nil),
+	)
+
+	err := database.WithTx(context.Background(), mockDB, func(tx database.Tx) error {
+		return failure
+	})
+
+	assert.ErrorIs(t, err, failure)
+}
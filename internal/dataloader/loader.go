@@ -0,0 +1,66 @@
+package dataloader
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Loader collects the keys requested within a short window and fetches them
+// with one call. Results aren't cached, so a loader can live as long as a
+// subscription does.
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+	wait  time.Duration
+
+	mu    sync.Mutex
+	batch *batch[K, V]
+}
+
+type batch[K comparable, V any] struct {
+	keys    []K
+	seen    map[K]struct{}
+	done    chan struct{}
+	results map[K]V
+	err     error
+}
+
+func New[K comparable, V any](wait time.Duration, fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, wait: wait}
+}
+
+// Load blocks until the batch containing key has been fetched. The batch is
+// fetched with the context of the call that started it.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	b := l.batch
+	if b == nil {
+		b = &batch[K, V]{seen: make(map[K]struct{}), done: make(chan struct{})}
+		l.batch = b
+		time.AfterFunc(l.wait, func() { l.run(ctx, b) })
+	}
+	if _, ok := b.seen[key]; !ok {
+		b.seen[key] = struct{}{}
+		b.keys = append(b.keys, key)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return b.results[key], b.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *Loader[K, V]) run(ctx context.Context, b *batch[K, V]) {
+	l.mu.Lock()
+	if l.batch == b {
+		l.batch = nil
+	}
+	l.mu.Unlock()
+
+	b.results, b.err = l.fetch(ctx, b.keys)
+	close(b.done)
+}
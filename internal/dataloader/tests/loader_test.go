@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"ozon-GraphQL/internal/dataloader"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoaderBatchesConcurrentLoads(t *testing.T) {
+	var calls [][]string
+	var mu sync.Mutex
+	loader := dataloader.New(5*time.Millisecond, func(ctx context.Context, keys []string) (map[string]string, error) {
+		mu.Lock()
+		calls = append(calls, keys)
+		mu.Unlock()
+
+		results := make(map[string]string)
+		for _, key := range keys {
+			results[key] = strings.ToUpper(key)
+		}
+		return results, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]string, 4)
+	for i, key := range []string{"a", "b", "a", "c"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = loader.Load(context.Background(), key)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, []string{"A", "B", "A", "C"}, results)
+	assert.Len(t, calls, 1)
+	assert.ElementsMatch(t, []string{"a", "b", "c"}, calls[0])
+
+	value, err := loader.Load(context.Background(), "d")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "D", value)
+	assert.Len(t, calls, 2)
+}
+
+func TestLoaderReturnsFetchError(t *testing.T) {
+	loader := dataloader.New(time.Millisecond, func(ctx context.Context, keys []int) (map[int]int, error) {
+		return nil, errors.New("boom")
+	})
+
+	_, err := loader.Load(context.Background(), 1)
+
+	assert.EqualError(t, err, "boom")
+}
@@ -0,0 +1,161 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Policy decides what happens to a subscriber whose buffer is full.
+type Policy int
+
+const (
+	// DropMessage skips the message for the slow subscriber and keeps it subscribed.
+	DropMessage Policy = iota
+	// Disconnect unsubscribes the slow subscriber and closes its channel.
+	Disconnect
+)
+
+// DefaultBufferSize is used when Options.BufferSize isn't positive.
+const DefaultBufferSize = 16
+
+func ParsePolicy(s string) (Policy, error) {
+	switch s {
+	case "", "drop":
+		return DropMessage, nil
+	case "disconnect":
+		return Disconnect, nil
+	default:
+		return 0, fmt.Errorf("unknown slow consumer policy %q", s)
+	}
+}
+
+type Options struct {
+	BufferSize int
+	Policy     Policy
+}
+
+type Broker[T any] interface {
+	// Publish delivers msg to the subscribers of every topic.
+	Publish(ctx context.Context, msg T, topics ...string) error
+	Subscribe(topic string) *Subscription[T]
+	// Close ends every subscription of the topic.
+	Close(ctx context.Context, topic string) error
+	// Options returns the options in effect, with defaults filled in.
+	Options() Options
+}
+
+type Subscription[T any] struct {
+	topic  string
+	ch     chan T
+	closed bool
+	broker *MemoryBroker[T]
+}
+
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+func (s *Subscription[T]) Unsubscribe() {
+	s.broker.remove(s)
+}
+
+// MemoryBroker fans out every published message to all subscribers of a topic
+// inside the current process.
+type MemoryBroker[T any] struct {
+	opts   Options
+	topics map[string]map[*Subscription[T]]struct{}
+	mu     sync.Mutex
+}
+
+func NewMemoryBroker[T any](opts Options) *MemoryBroker[T] {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	return &MemoryBroker[T]{
+		opts:   opts,
+		topics: make(map[string]map[*Subscription[T]]struct{}),
+	}
+}
+
+func (b *MemoryBroker[T]) Subscribe(topic string) *Subscription[T] {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription[T]{
+		topic:  topic,
+		ch:     make(chan T, b.opts.BufferSize),
+		broker: b,
+	}
+
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[*Subscription[T]]struct{})
+		b.topics[topic] = subs
+	}
+	subs[sub] = struct{}{}
+
+	return sub
+}
+
+// Publish never blocks: subscribers that can't keep up are handled according
+// to the broker's Policy.
+func (b *MemoryBroker[T]) Publish(ctx context.Context, msg T, topics ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, topic := range topics {
+		for sub := range b.topics[topic] {
+			select {
+			case sub.ch <- msg:
+			default:
+				if b.opts.Policy == Disconnect {
+					b.removeLocked(sub)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker[T]) Close(ctx context.Context, topic string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.topics[topic] {
+		b.removeLocked(sub)
+	}
+	return nil
+}
+
+func (b *MemoryBroker[T]) Options() Options {
+	return b.opts
+}
+
+func (b *MemoryBroker[T]) Subscribers(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.topics[topic])
+}
+
+func (b *MemoryBroker[T]) remove(sub *Subscription[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.removeLocked(sub)
+}
+
+func (b *MemoryBroker[T]) removeLocked(sub *Subscription[T]) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.ch)
+
+	subs := b.topics[sub.topic]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.topics, sub.topic)
+	}
+}
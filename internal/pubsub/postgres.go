@@ -0,0 +1,189 @@
+package pubsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"log"
+	"ozon-GraphQL/internal/database"
+	"time"
+)
+
+const (
+	reconnectDelay = time.Second
+	// notifyTimeout bounds a NOTIFY on the mutation path, which shouldn't
+	// hang on an exhausted pool.
+	notifyTimeout = 2 * time.Second
+	// maxPayloadSize keeps NOTIFY payloads below the 8000 bytes Postgres
+	// accepts.
+	maxPayloadSize = 7900
+)
+
+// notification refers to the message by the ID of its row, so that it fits
+// in a NOTIFY payload whatever the size of the row, and lists all of its
+// topics, so that listeners load the row once.
+type notification struct {
+	Topics []string `json:"topics"`
+	ID     string   `json:"id,omitempty"`
+	Close  bool     `json:"close,omitempty"`
+}
+
+// PostgresBroker publishes through Postgres NOTIFY so that every app instance
+// listening on the same channel delivers the message to its local subscribers.
+type PostgresBroker[T any] struct {
+	db      database.Database
+	connect func(ctx context.Context) (*pgx.Conn, error)
+	channel string
+	// id and load turn a message into the ID of its row and back.
+	id    func(msg T) string
+	load  func(ctx context.Context, id string) (T, error)
+	local *MemoryBroker[T]
+}
+
+func NewPostgresBroker[T any](db database.Database, connect func(ctx context.Context) (*pgx.Conn, error), channel string,
+	id func(msg T) string, load func(ctx context.Context, id string) (T, error), opts Options) *PostgresBroker[T] {
+	return &PostgresBroker[T]{
+		db:      db,
+		connect: connect,
+		channel: channel,
+		id:      id,
+		load:    load,
+		local:   NewMemoryBroker[T](opts),
+	}
+}
+
+// Publish doesn't deliver locally: the instance receives its own notification
+// through Listen like every other instance does. Subscribers get the row as
+// it is when the notification arrives. All topics go in one notification
+// unless they don't fit in a payload.
+func (b *PostgresBroker[T]) Publish(ctx context.Context, msg T, topics ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	n := notification{ID: b.id(msg)}
+	for _, topic := range topics {
+		n.Topics = append(n.Topics, topic)
+		if len(n.Topics) == 1 {
+			continue
+		}
+		payload, err := encodeNotification(n)
+		if err != nil {
+			return err
+		}
+		if len(payload) > maxPayloadSize {
+			n.Topics = n.Topics[:len(n.Topics)-1]
+			if err := b.notify(ctx, n); err != nil {
+				return err
+			}
+			n.Topics = []string{topic}
+		}
+	}
+	if len(n.Topics) == 0 {
+		return nil
+	}
+	return b.notify(ctx, n)
+}
+
+func (b *PostgresBroker[T]) Close(ctx context.Context, topic string) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	return b.notify(ctx, notification{Topics: []string{topic}, Close: true})
+}
+
+func (b *PostgresBroker[T]) notify(ctx context.Context, n notification) error {
+	payload, err := encodeNotification(n)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.Exec(ctx, `SELECT pg_notify($1, $2)`, b.channel, payload)
+	return err
+}
+
+func encodeNotification(n notification) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(n); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (b *PostgresBroker[T]) Subscribe(topic string) *Subscription[T] {
+	return b.local.Subscribe(topic)
+}
+
+func (b *PostgresBroker[T]) Options() Options {
+	return b.local.Options()
+}
+
+// Listen blocks until ctx is cancelled, reconnecting whenever the listening
+// connection is lost.
+func (b *PostgresBroker[T]) Listen(ctx context.Context) {
+	for {
+		err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("listener on channel %s stopped: %v, reconnecting", b.channel, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (b *PostgresBroker[T]) listen(ctx context.Context) error {
+	conn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{b.channel}.Sanitize()); err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var msg notification
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			log.Printf("skipping malformed notification on channel %s: %v", b.channel, err)
+			continue
+		}
+		if msg.Close {
+			for _, topic := range msg.Topics {
+				err = errors.Join(err, b.local.Close(ctx, topic))
+			}
+		} else {
+			err = b.deliver(ctx, msg)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to deliver notification: %w", err)
+		}
+	}
+}
+
+func (b *PostgresBroker[T]) deliver(ctx context.Context, n notification) error {
+	data, err := b.load(ctx, n.ID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		// The row may be gone already, that's no reason to stop listening.
+		log.Printf("skipping notification for %s on channel %s: %v", n.ID, b.channel, err)
+		return nil
+	}
+	return b.local.Publish(ctx, data, n.Topics...)
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"ozon-GraphQL/internal/pubsub"
+	"testing"
+)
+
+func TestBrokerFanOut(t *testing.T) {
+	broker := pubsub.NewMemoryBroker[string](pubsub.Options{})
+	ctx := context.Background()
+
+	first := broker.Subscribe("post1")
+	second := broker.Subscribe("post1")
+	other := broker.Subscribe("post2")
+
+	err := broker.Publish(ctx, "hello", "post1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", <-first.C())
+	assert.Equal(t, "hello", <-second.C())
+	assert.Len(t, other.C(), 0)
+}
+
+func TestBrokerUnsubscribeKeepsOtherSubscribers(t *testing.T) {
+	broker := pubsub.NewMemoryBroker[string](pubsub.Options{})
+	ctx := context.Background()
+
+	first := broker.Subscribe("post1")
+	second := broker.Subscribe("post1")
+
+	first.Unsubscribe()
+	first.Unsubscribe()
+	broker.Publish(ctx, "hello", "post1")
+
+	_, ok := <-first.C()
+	assert.False(t, ok)
+	assert.Equal(t, "hello", <-second.C())
+	assert.Equal(t, 1, broker.Subscribers("post1"))
+}
+
+func TestBrokerDropPolicy(t *testing.T) {
+	broker := pubsub.NewMemoryBroker[int](pubsub.Options{BufferSize: 1, Policy: pubsub.DropMessage})
+	ctx := context.Background()
+
+	sub := broker.Subscribe("post1")
+
+	broker.Publish(ctx, 1, "post1")
+	broker.Publish(ctx, 2, "post1")
+
+	assert.Equal(t, 1, <-sub.C())
+	assert.Len(t, sub.C(), 0)
+	assert.Equal(t, 1, broker.Subscribers("post1"))
+}
+
+func TestBrokerDisconnectPolicy(t *testing.T) {
+	broker := pubsub.NewMemoryBroker[int](pubsub.Options{BufferSize: 1, Policy: pubsub.Disconnect})
+	ctx := context.Background()
+
+	slow := broker.Subscribe("post1")
+	fast := broker.Subscribe("post1")
+
+	broker.Publish(ctx, 1, "post1")
+	<-fast.C()
+	broker.Publish(ctx, 2, "post1")
+
+	assert.Equal(t, 1, <-slow.C())
+	_, ok := <-slow.C()
+	assert.False(t, ok)
+	assert.Equal(t, 2, <-fast.C())
+	assert.Equal(t, 1, broker.Subscribers("post1"))
+}
+
+func TestBrokerClose(t *testing.T) {
+	broker := pubsub.NewMemoryBroker[string](pubsub.Options{})
+	ctx := context.Background()
+
+	first := broker.Subscribe("post1")
+	second := broker.Subscribe("post1")
+	other := broker.Subscribe("post2")
+
+	err := broker.Close(ctx, "post1")
+
+	assert.NoError(t, err)
+	_, ok := <-first.C()
+	assert.False(t, ok)
+	_, ok = <-second.C()
+	assert.False(t, ok)
+	assert.Equal(t, 0, broker.Subscribers("post1"))
+	assert.Equal(t, 1, broker.Subscribers("post2"))
+
+	second.Unsubscribe()
+	other.Unsubscribe()
+}
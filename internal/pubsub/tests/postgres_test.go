@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"ozon-GraphQL/internal/database/storage/mocks"
+	"ozon-GraphQL/internal/pubsub"
+	"strings"
+	"testing"
+)
+
+type row struct {
+	ID      string
+	Content string
+}
+
+func newPostgresBroker(mockDB *mocks.MockDatabase) *pubsub.PostgresBroker[row] {
+	return pubsub.NewPostgresBroker[row](mockDB, nil, "comment_added",
+		func(msg row) string { return msg.ID },
+		func(ctx context.Context, id string) (row, error) { return row{ID: id}, nil },
+		pubsub.Options{})
+}
+
+func TestPostgresBrokerPublishNotifies(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	broker := newPostgresBroker(mockDB)
+
+	mockDB.EXPECT().
+		Exec(gomock.Any(), gomock.Any(), "comment_added", `{"topics":["post:1","thread:<3>"],"id":"<7>"}`+"\n").
+		DoAndReturn(func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+			_, ok := ctx.Deadline()
+			assert.True(t, ok, "NOTIFY must not wait forever")
+			return pgconn.CommandTag("SELECT 1"), nil
+		}).
+		Times(1)
+
+	err := broker.Publish(context.Background(), row{ID: "<7>", Content: "hello"}, "post:1", "thread:<3>")
+
+	assert.NoError(t, err)
+}
+
+func TestPostgresBrokerSplitsTopicsThatDontFitInOnePayload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	broker := newPostgresBroker(mockDB)
+
+	var topics []string
+	for i := 0; i < 500; i++ {
+		topics = append(topics, fmt.Sprintf("thread:%036d", i))
+	}
+
+	var notified []string
+	mockDB.EXPECT().
+		Exec(gomock.Any(), gomock.Any(), "comment_added", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+			payload := args[1].(string)
+			assert.Less(t, len(payload), 8000)
+			var n struct{ Topics []string }
+			require.NoError(t, json.Unmarshal([]byte(payload), &n))
+			notified = append(notified, n.Topics...)
+			return pgconn.CommandTag("SELECT 1"), nil
+		}).
+		MinTimes(2)
+
+	err := broker.Publish(context.Background(), row{ID: "7"}, topics...)
+
+	assert.NoError(t, err)
+	assert.Equal(t, topics, notified)
+}
+
+func TestPostgresBrokerPublishesLargeMessagesByID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockDB := mocks.NewMockDatabase(ctrl)
+	broker := newPostgresBroker(mockDB)
+
+	// Every control character takes 6 bytes in JSON, far more than the
+	// 8000 bytes NOTIFY accepts.
+	content := strings.Repeat("\x01", 2000)
+
+	mockDB.EXPECT().
+		Exec(gomock.Any(), gomock.Any(), "comment_added", gomock.Any()).
+		DoAndReturn(func(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+			payload := args[1].(string)
+			assert.Less(t, len(payload), 8000)
+			assert.NotContains(t, payload, `\u0001`)
+			return pgconn.CommandTag("SELECT 1"), nil
+		}).
+		Times(1)
+
+	err := broker.Publish(context.Background(), row{ID: "7", Content: content}, "post:1")
+
+	assert.NoError(t, err)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/vektah/gqlparser/v2/ast"
+	"ozon-GraphQL/graph"
+	"time"
+)
+
+type Config struct {
+	WebsocketEnabled      bool
+	KeepAlivePingInterval time.Duration
+	InitTimeout           time.Duration
+	// InitFunc is called with the connection_init payload of every websocket
+	// connection; returning an error rejects the connection.
+	InitFunc transport.WebsocketInitFunc
+
+	SSEEnabled           bool
+	SSEKeepAliveInterval time.Duration
+
+	// ComplexityLimit and MaxDepth reject expensive operations before they
+	// run; zero disables the check.
+	ComplexityLimit int
+	MaxDepth        int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		WebsocketEnabled:      true,
+		KeepAlivePingInterval: 10 * time.Second,
+		InitTimeout:           10 * time.Second,
+		SSEEnabled:            true,
+		SSEKeepAliveInterval:  10 * time.Second,
+		ComplexityLimit:       5000,
+		MaxDepth:              15,
+	}
+}
+
+func New(resolver *graph.Resolver, cfg Config) *handler.Server {
+	srv := handler.New(graph.NewExecutableSchema(graph.Config{
+		Resolvers:  resolver,
+		Complexity: graph.NewComplexityRoot(resolver.Pagination),
+	}))
+
+	if cfg.WebsocketEnabled {
+		initFunc := cfg.InitFunc
+		if initFunc == nil {
+			initFunc = acceptInit
+		}
+
+		// KeepAlivePingInterval is used by the legacy graphql-ws protocol,
+		// PingPongInterval by graphql-transport-ws.
+		srv.AddTransport(transport.Websocket{
+			InitFunc:              initFunc,
+			InitTimeout:           cfg.InitTimeout,
+			KeepAlivePingInterval: cfg.KeepAlivePingInterval,
+			PingPongInterval:      cfg.KeepAlivePingInterval,
+		})
+	}
+	srv.AddTransport(transport.Options{})
+	srv.AddTransport(transport.GET{})
+	// SSE has to go before POST: both accept JSON POST requests, SSE only
+	// claims the ones asking for text/event-stream.
+	if cfg.SSEEnabled {
+		srv.AddTransport(transport.SSE{KeepAlivePingInterval: cfg.SSEKeepAliveInterval})
+	}
+	srv.AddTransport(transport.POST{})
+
+	srv.SetErrorPresenter(graph.ErrorPresenter)
+	srv.SetQueryCache(lru.New[*ast.QueryDocument](1000))
+
+	srv.AroundOperations(func(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+		return next(graph.WithLoaders(ctx, resolver.Repo))
+	})
+
+	srv.Use(extension.Introspection{})
+	if cfg.ComplexityLimit > 0 {
+		srv.Use(extension.FixedComplexityLimit(cfg.ComplexityLimit))
+	}
+	if cfg.MaxDepth > 0 {
+		srv.Use(depthLimit{maxDepth: cfg.MaxDepth})
+	}
+	srv.Use(extension.AutomaticPersistedQuery{
+		Cache: lru.New[string](100),
+	})
+
+	return srv
+}
+
+func acceptInit(ctx context.Context, initPayload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+	return ctx, nil, nil
+}
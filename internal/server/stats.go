@@ -0,0 +1,18 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"ozon-GraphQL/internal/database"
+)
+
+// PoolStatsHandler serves a snapshot of the connection pool as JSON for
+// monitoring.
+func PoolStatsHandler(stats func() database.PoolStats) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,676 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"ozon-GraphQL/graph"
+	"ozon-GraphQL/graph/model"
+	"ozon-GraphQL/internal/database"
+	"ozon-GraphQL/internal/database/storage"
+	"ozon-GraphQL/internal/pubsub"
+	"ozon-GraphQL/internal/server"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const commentAddedQuery = `subscription($postId: ID!) { commentAdded(postId: $postId) { id content } }`
+
+type commentAddedResponse struct {
+	CommentAdded struct {
+		ID      string
+		Content string
+	}
+}
+
+func newTestServer(t *testing.T, cfg server.Config) (http.Handler, *pubsub.MemoryBroker[*model.Comment], string) {
+	repo := storage.NewInMemoryRepository()
+	ctx := context.Background()
+	broker := pubsub.NewMemoryBroker[*model.Comment](pubsub.Options{})
+
+	post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	require.NoError(t, err)
+
+	posts := pubsub.NewMemoryBroker[*model.Post](pubsub.Options{})
+
+	return server.New(graph.NewResolver(repo, broker, posts), cfg), broker, post.ID
+}
+
+func createComment(t *testing.T, c *client.Client, postID, content string) string {
+	var resp struct {
+		CreateComment struct{ ID string }
+	}
+	c.MustPost(`mutation($postId: ID!, $content: String!) { createComment(authorId: "2", postId: $postId, content: $content) { id } }`,
+		&resp, client.Var("postId", postID), client.Var("content", content))
+	return resp.CreateComment.ID
+}
+
+func createReply(t *testing.T, c *client.Client, postID, parentID, content string) string {
+	var resp struct {
+		CreateReply struct{ ID string }
+	}
+	c.MustPost(`mutation($postId: ID!, $parentId: ID!, $content: String!) { createReply(authorId: "3", postId: $postId, parentId: $parentId, content: $content) { id } }`,
+		&resp, client.Var("postId", postID), client.Var("parentId", parentID), client.Var("content", content))
+	return resp.CreateReply.ID
+}
+
+func TestWebsocketCommentAdded(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.KeepAlivePingInterval = 50 * time.Millisecond
+
+	var initPayload transport.InitPayload
+	cfg.InitFunc = func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		initPayload = payload
+		return ctx, nil, nil
+	}
+
+	h, broker, postID := newTestServer(t, cfg)
+	c := client.New(h)
+
+	sub := c.WebsocketWithPayload(commentAddedQuery, map[string]any{"clientId": "test"}, client.Var("postId", postID))
+	defer sub.Close()
+
+	assert.Eventually(t, func() bool { return broker.Subscribers("post:"+postID) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "test", initPayload["clientId"])
+
+	createComment(t, c, postID, "Nice post!")
+
+	var resp commentAddedResponse
+	require.NoError(t, sub.Next(&resp))
+	assert.Equal(t, "Nice post!", resp.CommentAdded.Content)
+}
+
+func TestWebsocketCommentAddedSince(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.KeepAlivePingInterval = 50 * time.Millisecond
+
+	h, broker, postID := newTestServer(t, cfg)
+	c := client.New(h)
+
+	seen := createComment(t, c, postID, "first")
+	createComment(t, c, postID, "second")
+	createComment(t, c, postID, "third")
+
+	sub := c.Websocket(`subscription($postId: ID!, $since: String) { commentAdded(postId: $postId, since: $since) { id content } }`,
+		client.Var("postId", postID), client.Var("since", seen))
+	defer sub.Close()
+
+	assert.Eventually(t, func() bool { return broker.Subscribers("post:"+postID) == 1 }, time.Second, 10*time.Millisecond)
+
+	createComment(t, c, postID, "fourth")
+
+	var contents []string
+	for i := 0; i < 3; i++ {
+		var resp commentAddedResponse
+		require.NoError(t, sub.Next(&resp))
+		contents = append(contents, resp.CommentAdded.Content)
+	}
+	assert.Equal(t, []string{"second", "third", "fourth"}, contents)
+}
+
+// slowReplayRepository loads the second replay page and holds it until
+// release is closed.
+type slowReplayRepository struct {
+	database.Repository
+	calls   atomic.Int32
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (r *slowReplayRepository) GetPostComments(ctx context.Context, postID string, page database.Page) (*model.CommentConnection, error) {
+	conn, err := r.Repository.GetPostComments(ctx, postID, page)
+	if r.calls.Add(1) == 2 {
+		close(r.blocked)
+		<-r.release
+	}
+	return conn, err
+}
+
+// replayWithLiveComments subscribes with since while the replay of persisted
+// comments is held halfway and live comments are posted meanwhile. It returns
+// what the subscriber receives until the subscription ends or goes quiet.
+func replayWithLiveComments(t *testing.T, opts pubsub.Options, persisted, live int) (contents []string, ended bool) {
+	cfg := server.DefaultConfig()
+	cfg.KeepAlivePingInterval = 50 * time.Millisecond
+
+	repo := &slowReplayRepository{
+		Repository: storage.NewInMemoryRepository(),
+		blocked:    make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	ctx := context.Background()
+	post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	require.NoError(t, err)
+
+	broker := pubsub.NewMemoryBroker[*model.Comment](opts)
+	posts := pubsub.NewMemoryBroker[*model.Post](pubsub.Options{})
+	h := server.New(graph.NewResolver(repo, broker, posts), cfg)
+	c := client.New(h)
+
+	// Live comments go through a real connection, like they would from
+	// other clients.
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	seen, err := repo.CreateComment(ctx, "2", post.ID, "seen")
+	require.NoError(t, err)
+	for i := 0; i < persisted; i++ {
+		_, err := repo.CreateComment(ctx, "2", post.ID, "persisted")
+		require.NoError(t, err)
+	}
+
+	sub := c.Websocket(`subscription($postId: ID!, $since: String) { commentAdded(postId: $postId, since: $since) { id content } }`,
+		client.Var("postId", post.ID), client.Var("since", seen.ID))
+	defer sub.Close()
+
+	<-repo.blocked
+	for i := 0; i < live; i++ {
+		body := `{"query":"mutation { createComment(authorId: \"2\", postId: \"` + post.ID + `\", content: \"live\") { id } }"}`
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	close(repo.release)
+
+	received := make(chan string)
+	go func() {
+		defer close(received)
+		for {
+			var resp commentAddedResponse
+			if err := sub.Next(&resp); err != nil || resp.CommentAdded.ID == "" {
+				return
+			}
+			received <- resp.CommentAdded.Content
+		}
+	}()
+
+	for {
+		select {
+		case content, ok := <-received:
+			if !ok {
+				return contents, true
+			}
+			contents = append(contents, content)
+		case <-time.After(time.Second):
+			return contents, false
+		}
+	}
+}
+
+func TestWebsocketCommentAddedSinceKeepsCommentsPostedDuringReplay(t *testing.T) {
+	// Two replay pages, and as many live comments as the buffer holds.
+	contents, ended := replayWithLiveComments(t, pubsub.Options{BufferSize: 4}, 150, 4)
+
+	assert.False(t, ended)
+	require.Len(t, contents, 154)
+	assert.Equal(t, "persisted", contents[149])
+	for _, content := range contents[150:] {
+		assert.Equal(t, "live", content)
+	}
+}
+
+func TestWebsocketCommentAddedSinceDisconnectsWhenReplayFallsBehind(t *testing.T) {
+	contents, ended := replayWithLiveComments(t, pubsub.Options{BufferSize: 4, Policy: pubsub.Disconnect}, 150, 20)
+
+	assert.True(t, ended)
+	assert.LessOrEqual(t, len(contents), 150+8)
+	assert.Equal(t, "persisted", contents[149])
+}
+
+func TestWebsocketReplyAddedToSubtree(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.KeepAlivePingInterval = 50 * time.Millisecond
+
+	h, broker, postID := newTestServer(t, cfg)
+	c := client.New(h)
+
+	root := createComment(t, c, postID, "root")
+	child := createReply(t, c, postID, root, "child")
+
+	sub := c.Websocket(`subscription($commentId: ID!) { replyAdded(commentId: $commentId) { id content } }`,
+		client.Var("commentId", root))
+	defer sub.Close()
+
+	assert.Eventually(t, func() bool { return broker.Subscribers("thread:"+root) == 1 }, time.Second, 10*time.Millisecond)
+
+	createComment(t, c, postID, "unrelated")
+	createReply(t, c, postID, child, "grandchild")
+
+	var resp struct {
+		ReplyAdded struct {
+			ID      string
+			Content string
+		}
+	}
+	require.NoError(t, sub.Next(&resp))
+	assert.Equal(t, "grandchild", resp.ReplyAdded.Content)
+}
+
+func TestWebsocketCommentAddedByAuthor(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.KeepAlivePingInterval = 50 * time.Millisecond
+
+	h, broker, postID := newTestServer(t, cfg)
+	c := client.New(h)
+
+	sub := c.Websocket(`subscription { commentAddedByAuthor(authorId: "2") { id content } }`)
+	defer sub.Close()
+
+	assert.Eventually(t, func() bool { return broker.Subscribers("author:2") == 1 }, time.Second, 10*time.Millisecond)
+
+	createComment(t, c, postID, "by author 2")
+
+	var resp struct {
+		CommentAddedByAuthor struct {
+			ID      string
+			Content string
+		}
+	}
+	require.NoError(t, sub.Next(&resp))
+	assert.Equal(t, "by author 2", resp.CommentAddedByAuthor.Content)
+}
+
+func TestCommentAddedCompletesWhenCommentsDisabled(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.KeepAlivePingInterval = 50 * time.Millisecond
+
+	h, broker, postID := newTestServer(t, cfg)
+	c := client.New(h)
+
+	sub := c.Websocket(commentAddedQuery, client.Var("postId", postID))
+	defer sub.Close()
+
+	assert.Eventually(t, func() bool { return broker.Subscribers("post:"+postID) == 1 }, time.Second, 10*time.Millisecond)
+
+	var resp struct {
+		SetPostCommentsEnabled struct{ AllowComments bool }
+	}
+	c.MustPost(`mutation($postId: ID!) { setPostCommentsEnabled(postId: $postId, authorId: "1", enabled: false) { allowComments } }`,
+		&resp, client.Var("postId", postID))
+	assert.False(t, resp.SetPostCommentsEnabled.AllowComments)
+
+	var added commentAddedResponse
+	assert.ErrorContains(t, sub.Next(&added), "complete")
+	assert.Equal(t, 0, broker.Subscribers("post:"+postID))
+}
+
+func TestCreateReplyInLockedThread(t *testing.T) {
+	h, _, postID := newTestServer(t, server.DefaultConfig())
+	c := client.New(h)
+
+	root := createComment(t, c, postID, "root")
+	child := createReply(t, c, postID, root, "child")
+
+	var resp struct {
+		LockThread struct{ Locked bool }
+	}
+	c.MustPost(`mutation($commentId: ID!) { lockThread(commentId: $commentId, authorId: "1") { locked } }`,
+		&resp, client.Var("commentId", root))
+	assert.True(t, resp.LockThread.Locked)
+
+	var reply struct {
+		CreateReply struct{ ID string }
+	}
+	err := c.Post(`mutation($postId: ID!, $parentId: ID!) { createReply(authorId: "3", postId: $postId, parentId: $parentId, content: "blocked") { id } }`,
+		&reply, client.Var("postId", postID), client.Var("parentId", child))
+	assert.ErrorContains(t, err, "thread is locked")
+}
+
+func TestWebsocketInitRejected(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.InitFunc = func(ctx context.Context, payload transport.InitPayload) (context.Context, *transport.InitPayload, error) {
+		return ctx, nil, errors.New("unauthorized")
+	}
+
+	h, _, postID := newTestServer(t, cfg)
+	c := client.New(h)
+
+	sub := c.Websocket(commentAddedQuery, client.Var("postId", postID))
+	defer sub.Close()
+
+	var resp commentAddedResponse
+	assert.Error(t, sub.Next(&resp))
+}
+
+func TestSSECommentAdded(t *testing.T) {
+	h, broker, postID := newTestServer(t, server.DefaultConfig())
+	c := client.New(h)
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	body := `{"query":"subscription { commentAdded(postId: \"` + postID + `\") { id content } }"}`
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	assert.Eventually(t, func() bool { return broker.Subscribers("post:"+postID) == 1 }, time.Second, 10*time.Millisecond)
+
+	createComment(t, c, postID, "Nice post!")
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if strings.HasPrefix(line, "data: ") {
+			assert.Contains(t, line, `"content":"Nice post!"`)
+			return
+		}
+	}
+}
+
+func TestCommentsLastWithTotalCount(t *testing.T) {
+	h, _, postID := newTestServer(t, server.DefaultConfig())
+	c := client.New(h)
+
+	createComment(t, c, postID, "first")
+	createComment(t, c, postID, "second")
+	createComment(t, c, postID, "third")
+
+	var resp struct {
+		Comments struct {
+			Edges []struct {
+				Node struct{ Content string }
+			}
+			PageInfo struct {
+				HasPreviousPage bool
+				HasNextPage     bool
+			}
+			TotalCount int
+		}
+	}
+	c.MustPost(`query($postId: ID!) { comments(postId: $postId, last: 2) { edges { node { content } } pageInfo { hasPreviousPage hasNextPage } totalCount } }`,
+		&resp, client.Var("postId", postID))
+
+	require.Len(t, resp.Comments.Edges, 2)
+	assert.Equal(t, "second", resp.Comments.Edges[0].Node.Content)
+	assert.Equal(t, "third", resp.Comments.Edges[1].Node.Content)
+	assert.True(t, resp.Comments.PageInfo.HasPreviousPage)
+	assert.False(t, resp.Comments.PageInfo.HasNextPage)
+	assert.Equal(t, 3, resp.Comments.TotalCount)
+
+	err := c.Post(`query($postId: ID!) { comments(postId: $postId, first: 1, last: 1) { totalCount } }`,
+		&resp, client.Var("postId", postID))
+	assert.ErrorContains(t, err, "first and last")
+}
+
+type countingRepository struct {
+	database.Repository
+	commentCalls      atomic.Int32
+	ancestorsCalls    atomic.Int32
+	repliesCalls      atomic.Int32
+	batchRepliesCalls atomic.Int32
+}
+
+func (r *countingRepository) GetCommentByID(ctx context.Context, id string) (*model.Comment, error) {
+	r.commentCalls.Add(1)
+	return r.Repository.GetCommentByID(ctx, id)
+}
+
+func (r *countingRepository) GetCommentAncestors(ctx context.Context, commentID string) ([]*model.Comment, error) {
+	r.ancestorsCalls.Add(1)
+	return r.Repository.GetCommentAncestors(ctx, commentID)
+}
+
+func (r *countingRepository) GetRepliesByCommentID(ctx context.Context, commentID string, page database.Page) (*model.CommentConnection, error) {
+	r.repliesCalls.Add(1)
+	return r.Repository.GetRepliesByCommentID(ctx, commentID, page)
+}
+
+func (r *countingRepository) GetRepliesByCommentIDs(ctx context.Context, commentIDs []string, page database.Page) (map[string]*model.CommentConnection, error) {
+	r.batchRepliesCalls.Add(1)
+	return r.Repository.GetRepliesByCommentIDs(ctx, commentIDs, page)
+}
+
+func newCountingServer(t *testing.T) (*client.Client, *countingRepository, string) {
+	repo := &countingRepository{Repository: storage.NewInMemoryRepository()}
+	ctx := context.Background()
+	post, err := repo.CreatePost(ctx, "1", "Title", "Content", true)
+	require.NoError(t, err)
+
+	h := server.New(graph.NewResolver(repo, pubsub.NewMemoryBroker[*model.Comment](pubsub.Options{}), pubsub.NewMemoryBroker[*model.Post](pubsub.Options{})), server.DefaultConfig())
+	return client.New(h), repo, post.ID
+}
+
+func TestCommentRepliesAreLoadedOnlyWhenSelected(t *testing.T) {
+	c, repo, postID := newCountingServer(t)
+
+	root := createComment(t, c, postID, "root")
+	createReply(t, c, postID, root, "first")
+	createReply(t, c, postID, root, "second")
+
+	var flat struct {
+		Comments struct {
+			Edges []struct{ Node struct{ ID string } }
+		}
+	}
+	c.MustPost(`query($postId: ID!) { comments(postId: $postId) { edges { node { id } } } }`,
+		&flat, client.Var("postId", postID))
+
+	assert.Len(t, flat.Comments.Edges, 1)
+	assert.Equal(t, int32(0), repo.repliesCalls.Load()+repo.batchRepliesCalls.Load())
+
+	var nested struct {
+		Comments struct {
+			Edges []struct {
+				Node struct {
+					Content string
+					Replies struct {
+						Edges    []struct{ Node struct{ Content string } }
+						PageInfo struct{ HasNextPage bool }
+					}
+				}
+			}
+		}
+	}
+	c.MustPost(`query($postId: ID!) { comments(postId: $postId, first: 1) { edges { node { content replies(first: 1) { edges { node { content } } pageInfo { hasNextPage } } } } } }`,
+		&nested, client.Var("postId", postID))
+
+	require.Len(t, nested.Comments.Edges, 1)
+	replies := nested.Comments.Edges[0].Node.Replies
+	require.Len(t, replies.Edges, 1)
+	assert.Equal(t, "first", replies.Edges[0].Node.Content)
+	assert.True(t, replies.PageInfo.HasNextPage)
+}
+
+func TestCommentRepliesAreBatchedPerLevel(t *testing.T) {
+	c, repo, postID := newCountingServer(t)
+
+	for _, content := range []string{"first", "second", "third"} {
+		root := createComment(t, c, postID, content)
+		reply := createReply(t, c, postID, root, content+" reply")
+		createReply(t, c, postID, reply, content+" nested reply")
+	}
+
+	var resp struct {
+		Comments struct {
+			Edges []struct {
+				Node struct {
+					Replies struct {
+						Edges []struct {
+							Node struct {
+								Replies struct {
+									Edges []struct{ Node struct{ Content string } }
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	c.MustPost(`query($postId: ID!) { comments(postId: $postId) { edges { node { replies { edges { node { replies { edges { node { content } } } } } } } } } }`,
+		&resp, client.Var("postId", postID))
+
+	assert.Len(t, resp.Comments.Edges, 3)
+	for _, edge := range resp.Comments.Edges {
+		require.Len(t, edge.Node.Replies.Edges, 1)
+		assert.Len(t, edge.Node.Replies.Edges[0].Node.Replies.Edges, 1)
+	}
+	assert.Equal(t, int32(0), repo.repliesCalls.Load())
+	assert.Equal(t, int32(2), repo.batchRepliesCalls.Load())
+}
+
+func TestCreateReplyLoadsThreadOnce(t *testing.T) {
+	c, repo, postID := newCountingServer(t)
+
+	root := createComment(t, c, postID, "root")
+	child := createReply(t, c, postID, root, "child")
+
+	repo.commentCalls.Store(0)
+	repo.ancestorsCalls.Store(0)
+	createReply(t, c, postID, child, "grandchild")
+
+	assert.Equal(t, int32(1), repo.ancestorsCalls.Load())
+	assert.Zero(t, repo.commentCalls.Load())
+}
+
+func TestDepthLimit(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.MaxDepth = 5
+	h, _, postID := newTestServer(t, cfg)
+	c := client.New(h)
+	createComment(t, c, postID, "hello")
+
+	var resp map[string]any
+	err := c.Post(`query($postId: ID!) { comments(postId: $postId) { edges { node { replies { edges { node { id } } } } } } }`,
+		&resp, client.Var("postId", postID))
+
+	assert.ErrorContains(t, err, "DEPTH_LIMIT_EXCEEDED")
+
+	err = c.Post(`query($postId: ID!) { comments(postId: $postId) { edges { node { id } } } }`,
+		&resp, client.Var("postId", postID))
+
+	assert.NoError(t, err)
+}
+
+func TestComplexityLimit(t *testing.T) {
+	cfg := server.DefaultConfig()
+	cfg.ComplexityLimit = 50
+	h, _, postID := newTestServer(t, cfg)
+	c := client.New(h)
+	createComment(t, c, postID, "hello")
+
+	var resp map[string]any
+	err := c.Post(`query($postId: ID!) { comments(postId: $postId, first: 5) { edges { node { replies(first: 5) { edges { node { id } } } } } } }`,
+		&resp, client.Var("postId", postID))
+
+	assert.ErrorContains(t, err, "COMPLEXITY_LIMIT_EXCEEDED")
+
+	err = c.Post(`query($postId: ID!) { comments(postId: $postId, first: 5) { edges { node { id } } } }`,
+		&resp, client.Var("postId", postID))
+
+	assert.NoError(t, err)
+}
+
+func TestPageSizeValidation(t *testing.T) {
+	h, _, postID := newTestServer(t, server.DefaultConfig())
+	c := client.New(h)
+	createComment(t, c, postID, "hello")
+
+	for _, query := range []string{
+		`query($postId: ID!) { comments(postId: $postId, first: 0) { edges { cursor } } }`,
+		`query($postId: ID!) { comments(postId: $postId, last: -1) { edges { cursor } } }`,
+		`query($postId: ID!) { comments(postId: $postId, first: 1000) { edges { cursor } } }`,
+		`query($postId: ID!) { comments(postId: $postId) { edges { node { replies(first: 0) { edges { cursor } } } } } }`,
+		`query($postId: ID!) { commentThread(postId: $postId, first: 1000) { edges { cursor } } }`,
+		`query { posts(first: -5) { edges { cursor } } }`,
+	} {
+		var resp map[string]any
+		err := c.Post(query, &resp, client.Var("postId", postID))
+		assert.ErrorContains(t, err, "BAD_USER_INPUT", query)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	h, _, postID := newTestServer(t, server.DefaultConfig())
+	c := client.New(h)
+	commentID := createComment(t, c, postID, "hello")
+
+	var resp map[string]any
+	c.MustPost(`mutation($postId: ID!) { setPostCommentsEnabled(postId: $postId, authorId: "1", enabled: false) { id } }`,
+		&resp, client.Var("postId", postID))
+
+	for query, code := range map[string]string{
+		`query { post(id: "missing") { id } }`: "NOT_FOUND",
+		`mutation($postId: ID!) { createComment(authorId: "2", postId: $postId, content: "hi") { id } }`:          "COMMENTS_DISABLED",
+		`query($postId: ID!) { comments(postId: $postId, after: "garbage") { edges { cursor } } }`:                "INVALID_CURSOR",
+		`mutation($postId: ID!) { deletePost(id: $postId, authorId: "2") { id } }`:                                "FORBIDDEN",
+		`mutation($postId: ID!) { setPostCommentsEnabled(postId: $postId, authorId: "2", enabled: true) { id } }`: "FORBIDDEN",
+		`mutation($commentId: ID!) { lockThread(commentId: $commentId, authorId: "2") { id } }`:                   "FORBIDDEN",
+	} {
+		err := c.Post(query, &resp, client.Var("postId", postID), client.Var("commentId", commentID))
+		assert.ErrorContains(t, err, `"code":"`+code+`"`, query)
+	}
+}
+
+func TestCommentsOfDeletedPostAreNotFound(t *testing.T) {
+	h, _, postID := newTestServer(t, server.DefaultConfig())
+	c := client.New(h)
+	commentID := createComment(t, c, postID, "hello")
+
+	var resp map[string]any
+	c.MustPost(`mutation($postId: ID!) { deletePost(id: $postId, authorId: "1") { id } }`,
+		&resp, client.Var("postId", postID))
+
+	for _, query := range []string{
+		`mutation($commentId: ID!) { updateComment(id: $commentId, authorId: "2", content: "edited") { content } }`,
+		`mutation($commentId: ID!) { deleteComment(id: $commentId, authorId: "2") { id } }`,
+		`mutation($commentId: ID!) { lockThread(commentId: $commentId, authorId: "1") { id } }`,
+	} {
+		err := c.Post(query, &resp, client.Var("commentId", commentID))
+		assert.ErrorContains(t, err, `"code":"NOT_FOUND"`, query)
+	}
+}
+
+type failingRepository struct {
+	database.Repository
+}
+
+func (r failingRepository) GetPostByID(ctx context.Context, id string) (*model.Post, error) {
+	return nil, errors.New("dial tcp 10.0.0.5:5432: connection refused")
+}
+
+func TestInternalErrorsAreMasked(t *testing.T) {
+	repo := failingRepository{Repository: storage.NewInMemoryRepository()}
+	broker := pubsub.NewMemoryBroker[*model.Comment](pubsub.Options{})
+	posts := pubsub.NewMemoryBroker[*model.Post](pubsub.Options{})
+	c := client.New(server.New(graph.NewResolver(repo, broker, posts), server.DefaultConfig()))
+
+	var resp map[string]any
+	err := c.Post(`query { post(id: "1") { id } }`, &resp)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "internal server error")
+	assert.Contains(t, err.Error(), "INTERNAL_SERVER_ERROR")
+	assert.NotContains(t, err.Error(), "10.0.0.5")
+}
+
+func TestPoolStatsHandler(t *testing.T) {
+	h := server.PoolStatsHandler(func() database.PoolStats {
+		return database.PoolStats{MaxConns: 10, TotalConns: 3, AcquiredConns: 1, IdleConns: 2}
+	})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pool", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `"maxConns":10`)
+	assert.Contains(t, rec.Body.String(), `"idleConns":2`)
+}
@@ -0,0 +1,7 @@
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS edited_at,
+    DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS edited_at,
+    DROP COLUMN IF EXISTS deleted_at;
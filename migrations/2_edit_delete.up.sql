@@ -0,0 +1,7 @@
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS edited_at timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
+
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS edited_at timestamptz,
+    ADD COLUMN IF NOT EXISTS deleted_at timestamptz;
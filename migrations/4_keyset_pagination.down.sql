@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS replies_comments_reply_comment_id_idx;
+DROP INDEX IF EXISTS comments_post_id_created_at_id_idx;
+DROP INDEX IF EXISTS posts_created_at_id_idx;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS created_at;
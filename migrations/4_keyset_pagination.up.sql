@@ -0,0 +1,5 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS created_at timestamptz NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS posts_created_at_id_idx ON posts (created_at, id);
+CREATE INDEX IF NOT EXISTS comments_post_id_created_at_id_idx ON comments (post_id, created_at, id);
+CREATE INDEX IF NOT EXISTS replies_comments_reply_comment_id_idx ON replies_comments (reply_comment_id);
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS comments_post_id_path_idx;
+DROP INDEX IF EXISTS comments_root_id_path_idx;
+DROP INDEX IF EXISTS comments_parent_id_idx;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS path,
+    DROP COLUMN IF EXISTS depth,
+    DROP COLUMN IF EXISTS root_id,
+    DROP COLUMN IF EXISTS parent_id;
+
+DROP FUNCTION IF EXISTS comment_path_segment(timestamptz, uuid);
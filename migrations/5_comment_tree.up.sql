@@ -0,0 +1,35 @@
+-- A comment's path is the path of its parent followed by its own segment.
+-- Segments start with the creation time, so ordering by path lists a thread
+-- depth-first with siblings oldest first.
+CREATE OR REPLACE FUNCTION comment_path_segment(created_at timestamptz, id uuid) RETURNS text
+    LANGUAGE sql STABLE AS
+$$ SELECT to_char(created_at AT TIME ZONE 'UTC', 'YYYYMMDDHH24MISSUS') || '-' || id::text $$;
+
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES comments(id),
+    ADD COLUMN IF NOT EXISTS root_id UUID REFERENCES comments(id),
+    ADD COLUMN IF NOT EXISTS depth INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS path TEXT COLLATE "C" NOT NULL DEFAULT '';
+
+WITH RECURSIVE tree AS (
+    SELECT c.id, NULL::uuid AS parent_id, c.id AS root_id, 0 AS depth,
+           comment_path_segment(c.created_at, c.id) AS path
+    FROM comments c
+    WHERE NOT EXISTS (SELECT 1 FROM replies_comments rc WHERE rc.reply_comment_id = c.id)
+    UNION ALL
+    SELECT c.id, t.id, t.root_id, t.depth + 1,
+           t.path || '/' || comment_path_segment(c.created_at, c.id)
+    FROM tree t
+    JOIN replies_comments rc ON rc.parent_comment_id = t.id
+    JOIN comments c ON c.id = rc.reply_comment_id
+)
+UPDATE comments c
+SET parent_id = tree.parent_id, root_id = tree.root_id, depth = tree.depth, path = tree.path
+FROM tree
+WHERE c.id = tree.id;
+
+ALTER TABLE comments ALTER COLUMN root_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments (parent_id);
+CREATE INDEX IF NOT EXISTS comments_root_id_path_idx ON comments (root_id, path);
+CREATE INDEX IF NOT EXISTS comments_post_id_path_idx ON comments (post_id, path);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS replies_comments (
+    parent_comment_id UUID NOT NULL,
+    reply_comment_id UUID NOT NULL,
+    PRIMARY KEY (parent_comment_id, reply_comment_id),
+    FOREIGN KEY (parent_comment_id) REFERENCES comments(id),
+    FOREIGN KEY (reply_comment_id) REFERENCES comments(id)
+);
+
+CREATE INDEX IF NOT EXISTS replies_comments_reply_comment_id_idx ON replies_comments (reply_comment_id);
+
+INSERT INTO replies_comments (parent_comment_id, reply_comment_id)
+SELECT parent_id, id FROM comments WHERE parent_id IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,20 @@
+-- comments.parent_id is the only record of the reply relation from here on.
+-- Refuse to drop the link table if the two have drifted apart.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM replies_comments rc
+        JOIN comments c ON c.id = rc.reply_comment_id
+        WHERE c.parent_id IS DISTINCT FROM rc.parent_comment_id
+    ) OR EXISTS (
+        SELECT 1 FROM comments c
+        WHERE c.parent_id IS NOT NULL
+          AND NOT EXISTS (SELECT 1 FROM replies_comments rc
+                          WHERE rc.reply_comment_id = c.id AND rc.parent_comment_id = c.parent_id)
+    ) THEN
+        RAISE EXCEPTION 'replies_comments disagrees with comments.parent_id';
+    END IF;
+END
+$$;
+
+DROP TABLE IF EXISTS replies_comments;
@@ -0,0 +1,38 @@
+-- The schema the Postgres migrations end up with. SQLite has no uuid or
+-- timestamptz types: IDs are UUIDs generated by the application and times are
+-- UTC text of fixed width, e.g. 2024-01-02T03:04:05.000006Z, so they sort as
+-- strings. A reply refers to its parent through parent_id only, there is no
+-- replies_comments table.
+CREATE TABLE IF NOT EXISTS posts (
+    id TEXT PRIMARY KEY,
+    author_id VARCHAR(255) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    allow_comments BOOLEAN NOT NULL,
+    created_at TEXT NOT NULL,
+    edited_at TEXT,
+    deleted_at TEXT
+);
+
+-- path is the path of the parent followed by the comment's own segment, see
+-- comment_path_segment in the Postgres migrations.
+CREATE TABLE IF NOT EXISTS comments (
+    id TEXT PRIMARY KEY,
+    author_id VARCHAR(255) NOT NULL,
+    post_id TEXT NOT NULL REFERENCES posts(id),
+    parent_id TEXT REFERENCES comments(id),
+    root_id TEXT NOT NULL REFERENCES comments(id),
+    depth INTEGER NOT NULL DEFAULT 0,
+    path TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    edited_at TEXT,
+    deleted_at TEXT,
+    locked BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS posts_created_at_id_idx ON posts (created_at, id);
+CREATE INDEX IF NOT EXISTS comments_post_id_created_at_id_idx ON comments (post_id, created_at, id);
+CREATE INDEX IF NOT EXISTS comments_parent_id_idx ON comments (parent_id);
+CREATE INDEX IF NOT EXISTS comments_root_id_path_idx ON comments (root_id, path);
+CREATE INDEX IF NOT EXISTS comments_post_id_path_idx ON comments (post_id, path);